@@ -6,10 +6,12 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	_ "time/tzdata" // tz names for ?tz= on images without zoneinfo
 
 	"openailogger/internal/config"
 	"openailogger/internal/server"
 	"openailogger/storage"
+	"openailogger/storage/file"
 	"openailogger/storage/memory"
 )
 
@@ -28,7 +30,27 @@ func main() {
 	var store storage.Store
 	switch cfg.Capture.Store {
 	case "memory":
-		store = memory.New()
+		store = memory.NewWithOptions(memory.Options{
+			MaxBytes:      int64(cfg.Capture.MaxMemoryMB) * 1024 * 1024,
+			ProviderIndex: cfg.Capture.MemoryIndex,
+		})
+	case "file":
+		path := cfg.Capture.FilePath
+		switch {
+		case cfg.Capture.FilePartition == "daily":
+			if path == "" {
+				path = "captures"
+			}
+			store, err = file.NewPartitioned(path)
+		case path == "":
+			path = "captures.log"
+			fallthrough
+		default:
+			store, err = file.New(path)
+		}
+		if err != nil {
+			log.Fatalf("Failed to open file store: %v", err)
+		}
 	default:
 		log.Fatalf("Unsupported storage type: %s", cfg.Capture.Store)
 	}
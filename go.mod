@@ -3,6 +3,6 @@ module openailogger
 go 1.24.2
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	github.com/google/uuid v1.6.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"openailogger/internal/proxy"
+)
+
+// DeadLetterQueue provides the records the store failed to save
+type DeadLetterQueue interface {
+	DeadLetters() []proxy.DeadLetter
+	RetryDeadLetters(ctx context.Context) (saved, failed int)
+}
+
+// handleDeadLetters handles GET /api/deadletter
+func (h *Handler) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queue, ok := h.replayer.(DeadLetterQueue)
+	if !ok {
+		http.Error(w, "Dead letters not available", http.StatusNotImplemented)
+		return
+	}
+
+	entries := queue.DeadLetters()
+	writeJSON(w, map[string]interface{}{
+		"records": entries,
+		"total":   len(entries),
+	})
+}
+
+// handleRetryDeadLetters handles POST /api/deadletter/retry
+func (h *Handler) handleRetryDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queue, ok := h.replayer.(DeadLetterQueue)
+	if !ok {
+		http.Error(w, "Dead letters not available", http.StatusNotImplemented)
+		return
+	}
+
+	saved, failed := queue.RetryDeadLetters(r.Context())
+	writeJSON(w, map[string]int{"saved": saved, "failed": failed})
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"openailogger/internal/config"
+	"openailogger/storage"
+	"openailogger/storage/memory"
+)
+
+// failingExportStore streams an export that fails partway through a record
+type failingExportStore struct {
+	*memory.Store
+}
+
+func (s failingExportStore) ExportNDJSON(ctx context.Context, q storage.Query) (io.ReadCloser, error) {
+	stream := strings.NewReader(`{"id":"r1","provider":"openai"}` + "\n" + `{"id":"r2","prov`)
+	return io.NopCloser(io.MultiReader(stream, failingReader{})), nil
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("disk read failed")
+}
+
+func TestExportStopsOnReadError(t *testing.T) {
+	mux := http.NewServeMux()
+	New(&config.Config{}, failingExportStore{memory.New()}, nil).RegisterRoutes(mux)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/export.json", `[{"id":"r1","provider":"openai"}`},
+		{"/api/export.json?fields=id", `[{"id":"r1"}`},
+		{"/api/export.ndjson?fields=id", `{"id":"r1"}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
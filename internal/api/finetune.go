@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"openailogger/storage"
+)
+
+// fineTuneExample is one line of an OpenAI chat fine-tuning dataset
+type fineTuneExample struct {
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// handleFineTuneExport handles GET /api/export.finetune.jsonl
+func (h *Handler) handleFineTuneExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := h.parseQuery(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query parameters: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Remove pagination for export
+	query.Limit = 0
+	query.Offset = 0
+
+	records, _, err := h.store.List(r.Context(), query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to export records: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", "attachment; filename=finetune.jsonl")
+
+	cw, done := compressResponse(w, r)
+	defer done()
+
+	encoder := json.NewEncoder(cw)
+	for i := range records {
+		example, ok := toFineTuneExample(&records[i])
+		if !ok {
+			continue
+		}
+		if err := encoder.Encode(example); err != nil {
+			return
+		}
+	}
+}
+
+// assistantReply is the assistant turn appended to the request messages
+type assistantReply struct {
+	Role      string      `json:"role"`
+	Content   interface{} `json:"content"`
+	ToolCalls interface{} `json:"tool_calls,omitempty"`
+}
+
+// toFineTuneExample converts a successful chat completion record into a
+// fine-tuning example. Non-chat and failed records are skipped.
+func toFineTuneExample(record *storage.Record) (*fineTuneExample, bool) {
+	if record.Error != nil || record.Status < 200 || record.Status >= 300 {
+		return nil, false
+	}
+
+	var request struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(record.RequestBody), &request); err != nil || len(request.Messages) == 0 {
+		return nil, false
+	}
+
+	var reply *assistantReply
+	if record.Stream {
+		reply = streamedAssistantMessage(record.ResponseBody)
+	} else {
+		reply = assistantMessage(record.ResponseBody)
+	}
+	if reply == nil {
+		return nil, false
+	}
+
+	replyJSON, err := json.Marshal(reply)
+	if err != nil {
+		return nil, false
+	}
+
+	return &fineTuneExample{Messages: append(request.Messages, replyJSON)}, true
+}
+
+// assistantMessage extracts the first choice's message from a chat completion
+func assistantMessage(body string) *assistantReply {
+	var response struct {
+		Choices []struct {
+			Message map[string]interface{} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal([]byte(body), &response); err != nil || len(response.Choices) == 0 {
+		return nil
+	}
+
+	message := response.Choices[0].Message
+	if message == nil {
+		return nil
+	}
+
+	return &assistantReply{
+		Role:      "assistant",
+		Content:   message["content"],
+		ToolCalls: message["tool_calls"],
+	}
+}
+
+// streamedAssistantMessage concatenates the content deltas of an SSE chat
+// completion stream into a single assistant message
+func streamedAssistantMessage(body string) *assistantReply {
+	var content strings.Builder
+	found := false
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "data:")
+		if !ok {
+			continue
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &chunk); err != nil {
+			continue
+		}
+
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.Content)
+			found = true
+		}
+	}
+
+	if !found {
+		return nil
+	}
+	return &assistantReply{Role: "assistant", Content: content.String()}
+}
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,28 +12,63 @@ import (
 	"strings"
 	"time"
 
+	"openailogger/internal/config"
 	"openailogger/storage"
 )
 
 // Handler provides REST API endpoints for the capture data
 type Handler struct {
-	store storage.Store
+	config      *config.Config
+	store       storage.Store
+	replayer    Replayer
+	health      HealthReporter
+	idempotency idempotencyCache
+	exports     chan struct{} // semaphore bounding concurrent exports
 }
 
-// New creates a new API handler
-func New(store storage.Store) *Handler {
-	return &Handler{store: store}
+// New creates a new API handler. The replayer may be nil, in which case the
+// replay endpoint is unavailable.
+func New(cfg *config.Config, store storage.Store, replayer Replayer) *Handler {
+	return &Handler{
+		config:   cfg,
+		store:    store,
+		replayer: replayer,
+		exports:  make(chan struct{}, cfg.Server.ExportLimit()),
+	}
+}
+
+// SetHealthReporter adds upstream probe results to the route health endpoint
+func (h *Handler) SetHealthReporter(health HealthReporter) {
+	h.health = health
 }
 
 // RegisterRoutes registers all API routes with the given mux
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/requests", h.handleRequests)
 	mux.HandleFunc("/api/requests/", h.handleRequestByID)
-	mux.HandleFunc("/api/export.ndjson", h.handleExport)
+	mux.HandleFunc("/api/requests/recent", h.handleRecent)
+	mux.HandleFunc("/api/export.ndjson", h.limitExports(h.handleExport))
+	mux.HandleFunc("/api/export.json", h.limitExports(h.handleExportJSON))
+	mux.HandleFunc("/api/export.finetune.jsonl", h.limitExports(h.handleFineTuneExport))
+	mux.HandleFunc("/api/compact", h.handleCompact)
+	mux.HandleFunc("/api/partitions/drop", h.handleDropPartitions)
+	mux.HandleFunc("/api/reprocess", h.handleReprocess)
+	mux.HandleFunc("/api/flush", h.handleFlush)
+	mux.HandleFunc("/api/deadletter", h.handleDeadLetters)
+	mux.HandleFunc("/api/deadletter/retry", h.handleRetryDeadLetters)
+	mux.HandleFunc("/api/routes/health", h.handleRoutesHealth)
+	mux.HandleFunc("/api/stats", h.handleStats)
+	mux.HandleFunc("/api/stats/sparkline", h.handleSparkline)
+	mux.HandleFunc("/api/schema", h.handleSchema)
 }
 
-// handleRequests handles GET /api/requests with filtering and pagination
+// handleRequests handles GET /api/requests with filtering and pagination,
+// and DELETE /api/requests to delete the matching records
 func (h *Handler) handleRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		h.handleBulkDelete(w, r)
+		return
+	}
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -48,8 +86,23 @@ func (h *Handler) handleRequests(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	loc := displayLocation(r)
+	for i := range records {
+		records[i].Timestamp = records[i].Timestamp.In(loc)
+	}
+
+	var listed interface{} = records
+	switch fields := r.URL.Query().Get("fields"); fields {
+	case "", "full":
+	case "summary":
+		listed = summarizeRecords(records)
+	default:
+		http.Error(w, fmt.Sprintf("Invalid query parameters: unknown fields %q", fields), http.StatusBadRequest)
+		return
+	}
+
 	response := map[string]interface{}{
-		"records": records,
+		"records": listed,
 		"total":   total,
 		"offset":  query.Offset,
 		"limit":   query.Limit,
@@ -59,6 +112,63 @@ func (h *Handler) handleRequests(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// bodylessRecord marshals a record without its bodies. The nil shadowing
+// fields take precedence over the embedded ones and are omitted.
+type bodylessRecord struct {
+	storage.Record
+	RequestBody           *struct{} `json:"request_body,omitempty"`
+	RequestForm           *struct{} `json:"request_form,omitempty"`
+	ResponseBody          *struct{} `json:"response_body,omitempty"`
+	RewrittenResponse     *struct{} `json:"rewritten_response_body,omitempty"`
+	ResponseChunks        *struct{} `json:"response_chunks,omitempty"`
+	WSMessages            *struct{} `json:"ws_messages,omitempty"`
+	ReconstructedResponse *struct{} `json:"reconstructed_response,omitempty"`
+}
+
+// summarizeRecords projects records for list views that don't show bodies
+func summarizeRecords(records []storage.Record) []bodylessRecord {
+	result := make([]bodylessRecord, len(records))
+	for i := range records {
+		result[i] = bodylessRecord{Record: records[i]}
+	}
+	return result
+}
+
+// handleRecent handles GET /api/requests/recent, returning summaries of the
+// latest n records for fast list rendering
+func (h *Handler) handleRecent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n := 20
+	if nStr := r.URL.Query().Get("n"); nStr != "" {
+		parsed, err := strconv.Atoi(nStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid n parameter", http.StatusBadRequest)
+			return
+		}
+		n = min(parsed, 500)
+	}
+
+	summaries, total, err := h.store.ListSummary(r.Context(), storage.Query{Limit: n, Sort: "-ts"})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list records: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	loc := displayLocation(r)
+	for i := range summaries {
+		summaries[i].Timestamp = summaries[i].Timestamp.In(loc)
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"records": summaries,
+		"total":   total,
+	})
+}
+
 // handleRequestByID handles individual request operations
 func (h *Handler) handleRequestByID(w http.ResponseWriter, r *http.Request) {
 	// Extract ID from path
@@ -70,16 +180,30 @@ func (h *Handler) handleRequestByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	id := parts[0]
+	action := ""
+	if len(parts) > 1 {
+		action = parts[1]
+	}
 
-	switch r.Method {
-	case http.MethodGet:
-		if len(parts) > 1 && parts[1] == "chunks" {
-			h.handleRequestChunks(w, r, id)
-		} else {
-			h.handleGetRequest(w, r, id)
-		}
-	case http.MethodDelete:
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.handleGetRequest(w, r, id)
+	case action == "" && r.Method == http.MethodDelete:
 		h.handleDeleteRequest(w, r, id)
+	case action == "chunks" && r.Method == http.MethodGet:
+		h.handleRequestChunks(w, r, id)
+	case action == "thread" && r.Method == http.MethodGet:
+		h.handleThread(w, r, id)
+	case action == "messages" && r.Method == http.MethodGet:
+		h.handleMessages(w, r, id)
+	case action == "redaction" && r.Method == http.MethodGet:
+		h.handleRedaction(w, r, id)
+	case action == "replay" && r.Method == http.MethodPost:
+		h.handleReplay(w, r, id)
+	case action == "notes" && r.Method == http.MethodPut:
+		h.handleUpdateNotes(w, r, id)
+	case action == "pin" && (r.Method == http.MethodPost || r.Method == http.MethodDelete):
+		h.handlePin(w, r, id, r.Method == http.MethodPost)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
@@ -97,6 +221,8 @@ func (h *Handler) handleGetRequest(w http.ResponseWriter, r *http.Request, id st
 		return
 	}
 
+	record.Timestamp = record.Timestamp.In(displayLocation(r))
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(record)
 }
@@ -129,17 +255,130 @@ func (h *Handler) handleRequestChunks(w http.ResponseWriter, r *http.Request, id
 		return
 	}
 
+	// Chunks are spaced out for realistic playback unless the caller, e.g.
+	// a script fetching the stream for analysis, asks for them all at once
+	delay := h.config.Server.ChunkPlaybackDelay()
+	if r.URL.Query().Get("nodelay") == "true" {
+		delay = 0
+	}
+
 	for i, chunk := range record.ResponseChunks {
 		fmt.Fprintf(w, "data: %s\n\n", chunk)
 		flusher.Flush()
 
-		// Add small delay between chunks for realistic playback
-		if i < len(record.ResponseChunks)-1 {
-			time.Sleep(50 * time.Millisecond)
+		if delay > 0 && i < len(record.ResponseChunks)-1 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
 		}
 	}
 }
 
+// handleRedaction handles GET /api/requests/{id}/redaction, reporting how
+// many substitutions each mask made when the record's bodies were masked at
+// capture, before retention or sampling dropped or cut them. Masked values
+// themselves are never kept. Admin-only.
+func (h *Handler) handleRedaction(w http.ResponseWriter, r *http.Request, id string) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	record, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Record not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get record: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rules := make([]string, 0, len(h.config.Capture.Masks))
+	for i, mask := range h.config.Capture.Masks {
+		rules = append(rules, mask.RuleName(i))
+	}
+
+	substitutions := 0
+	matched := make(map[string]int, len(record.Redactions))
+	for name, count := range record.Redactions {
+		matched[name] = count
+		substitutions += count
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"id":            record.ID,
+		"rules":         rules,
+		"matched":       matched,
+		"substitutions": substitutions,
+	})
+}
+
+// authorizeAdmin answers 404 while no admin token is configured and 401 to
+// callers without it, reporting whether the request may proceed
+func (h *Handler) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token := h.config.Server.AdminToken
+	if token == "" {
+		http.Error(w, "Admin endpoints are disabled", http.StatusNotFound)
+		return false
+	}
+
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// handleUpdateNotes handles PUT /api/requests/{id}/notes
+func (h *Handler) handleUpdateNotes(w http.ResponseWriter, r *http.Request, id string) {
+	var body struct {
+		Notes string `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Only the notes change, concurrent pins and reprocessing are kept
+	record, err := storage.Modify(r.Context(), h.store, id, func(record *storage.Record) bool {
+		record.Notes = body.Notes
+		return true
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Record not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to update record: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// handlePin handles POST (pin) and DELETE (unpin) on /api/requests/{id}/pin
+func (h *Handler) handlePin(w http.ResponseWriter, r *http.Request, id string, pinned bool) {
+	record, err := storage.Modify(r.Context(), h.store, id, func(record *storage.Record) bool {
+		record.Pinned = pinned
+		return true
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Record not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to update record: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, record)
+}
+
 // handleDeleteRequest handles DELETE /api/requests/{id}
 func (h *Handler) handleDeleteRequest(w http.ResponseWriter, r *http.Request, id string) {
 	err := h.store.Delete(r.Context(), id)
@@ -155,6 +394,74 @@ func (h *Handler) handleDeleteRequest(w http.ResponseWriter, r *http.Request, id
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// bulkDeleteConfirmThreshold is the number of matching records above which
+// a bulk delete must echo the count back in the confirm parameter
+const bulkDeleteConfirmThreshold = 100
+
+// handleBulkDelete handles DELETE /api/requests, deleting the records that
+// match the query filters. Pinned records are kept unless the pinned filter
+// asks for them. With dryRun=true only the matching records are counted.
+func (h *Handler) handleBulkDelete(w http.ResponseWriter, r *http.Request) {
+	query, err := h.parseQuery(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query parameters: %v", err), http.StatusBadRequest)
+		return
+	}
+	query.Limit = 0
+	query.Offset = 0
+	if query.Pinned == nil {
+		unpinned := false
+		query.Pinned = &unpinned
+	}
+
+	matches, total, err := h.store.ListSummary(r.Context(), query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list records: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("dryRun") == "true" {
+		writeJSON(w, map[string]interface{}{"matched": total, "deleted": 0, "dry_run": true})
+		return
+	}
+
+	// Large deletes must be confirmed with the count a dry run reported, so
+	// a mistyped filter can't wipe the store
+	if total > bulkDeleteConfirmThreshold && r.URL.Query().Get("confirm") != strconv.Itoa(total) {
+		http.Error(w, fmt.Sprintf("Deleting %d records requires confirm=%d", total, total), http.StatusConflict)
+		return
+	}
+
+	deleted := 0
+	for _, match := range matches {
+		if err := h.store.Delete(r.Context(), match.ID); err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				continue // Deleted concurrently
+			}
+			http.Error(w, fmt.Sprintf("Failed to delete record: %v", err), http.StatusInternalServerError)
+			return
+		}
+		deleted++
+	}
+
+	writeJSON(w, map[string]interface{}{"matched": total, "deleted": deleted, "dry_run": false})
+}
+
+// limitExports rejects an export with 429 while the maximum number of
+// exports are already running
+func (h *Handler) limitExports(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case h.exports <- struct{}{}:
+			defer func() { <-h.exports }()
+			next(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too many concurrent exports", http.StatusTooManyRequests)
+		}
+	}
+}
+
 // handleExport handles GET /api/export.ndjson
 func (h *Handler) handleExport(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -167,6 +474,11 @@ func (h *Handler) handleExport(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Invalid query parameters: %v", err), http.StatusBadRequest)
 		return
 	}
+	fields, err := parseExportFields(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query parameters: %v", err), http.StatusBadRequest)
+		return
+	}
 
 	// Remove pagination for export
 	query.Limit = 0
@@ -182,7 +494,221 @@ func (h *Handler) handleExport(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/x-ndjson")
 	w.Header().Set("Content-Disposition", "attachment; filename=capture-export.ndjson")
 
-	io.Copy(w, reader)
+	cw, done := compressResponse(w, r)
+	defer done()
+
+	if fields == nil {
+		io.Copy(cw, reader)
+		return
+	}
+	if err := copyProjected(cw, reader, fields); err != nil {
+		return // Nothing more is written after a failed read or write
+	}
+}
+
+// handleExportJSON handles GET /api/export.json, framing the NDJSON export
+// as a single JSON array while it is streamed
+func (h *Handler) handleExportJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := h.parseQuery(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query parameters: %v", err), http.StatusBadRequest)
+		return
+	}
+	fields, err := parseExportFields(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query parameters: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Remove pagination for export
+	query.Limit = 0
+	query.Offset = 0
+
+	reader, err := h.store.ExportNDJSON(r.Context(), query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to export records: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=capture-export.json")
+
+	cw, done := compressResponse(w, r)
+	defer done()
+
+	lines := bufio.NewReader(reader)
+	separator := "["
+	for {
+		line, err := lines.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			// Leave the array unclosed so a failed read can't pass for a
+			// complete export
+			return
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if fields != nil {
+				projected, perr := projectRecord(line, fields)
+				if perr != nil {
+					return
+				}
+				line = projected
+			}
+			if _, werr := io.WriteString(cw, separator); werr != nil {
+				return
+			}
+			if _, werr := cw.Write(line); werr != nil {
+				return
+			}
+			separator = ",\n"
+		}
+		if err != nil {
+			break
+		}
+	}
+	if separator == "[" {
+		io.WriteString(cw, "[")
+	}
+	io.WriteString(cw, "]\n")
+}
+
+// handleCompact handles POST /api/compact
+func (h *Handler) handleCompact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	compactor, ok := h.store.(storage.Compactor)
+	if !ok {
+		http.Error(w, "Compaction not supported by this store", http.StatusNotImplemented)
+		return
+	}
+
+	if err := compactor.Compact(r.Context()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to compact store: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDropPartitions handles POST /api/partitions/drop?before=<time>,
+// removing the whole date partitions that end at or before it
+func (h *Handler) handleDropPartitions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dropper, ok := h.store.(storage.PartitionDropper)
+	if !ok {
+		http.Error(w, "Partition drops not supported by this store", http.StatusNotImplemented)
+		return
+	}
+
+	beforeStr := r.URL.Query().Get("before")
+	if beforeStr == "" {
+		http.Error(w, "Invalid query parameters: before is required", http.StatusBadRequest)
+		return
+	}
+	before, err := parseTimeExpr(beforeStr, time.Now(), false)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query parameters: invalid before parameter: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	dropped, err := dropper.DropBefore(r.Context(), before)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to drop partitions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]int{"dropped": dropped})
+}
+
+// handleFlush handles POST /api/flush. With a gateway it first waits for the
+// records still queued for storage, so everything captured so far is durable.
+func (h *Handler) handleFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := h.replayer.(storage.Flusher)
+	if !ok {
+		flusher, ok = h.store.(storage.Flusher)
+	}
+	if ok {
+		if err := flusher.Flush(r.Context()); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to flush store: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseTimeExpr parses an RFC3339 timestamp, a UTC date (the whole day, so
+// its end when endOfDay is set), "now", or an offset into the past such as
+// "-15m", "-1h" or "-7d"
+func parseTimeExpr(value string, now time.Time, endOfDay bool) (time.Time, error) {
+	if value == "now" {
+		return now, nil
+	}
+
+	if offset, ok := strings.CutPrefix(value, "-"); ok && offset != "" {
+		var d time.Duration
+		var err error
+		if n, unit := offset[:len(offset)-1], offset[len(offset)-1:]; unit == "d" || unit == "w" {
+			var count int
+			count, err = strconv.Atoi(n)
+			d = time.Duration(count) * 24 * time.Hour
+			if unit == "w" {
+				d *= 7
+			}
+		} else {
+			d, err = time.ParseDuration(offset)
+		}
+		if err != nil || d < 0 {
+			return time.Time{}, fmt.Errorf("unparseable relative time %q", value)
+		}
+		return now.Add(-d), nil
+	}
+
+	if day, err := time.Parse(time.DateOnly, value); err == nil {
+		if endOfDay {
+			return day.Add(24*time.Hour - time.Nanosecond), nil
+		}
+		return day, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// displayLocation returns the time zone named by the tz parameter that
+// response timestamps are formatted in, UTC when unset or unknown
+func displayLocation(r *http.Request) *time.Location {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
 }
 
 // parseQuery parses query parameters into a storage.Query
@@ -194,14 +720,25 @@ func (h *Handler) parseQuery(r *http.Request) (storage.Query, error) {
 
 	params := r.URL.Query()
 
-	// Provider filter
-	if provider := params.Get("provider"); provider != "" {
-		query.Provider = &provider
+	// Provider filter, repeated values match any
+	for _, provider := range params["provider"] {
+		if provider != "" {
+			query.Providers = append(query.Providers, provider)
+		}
 	}
 
-	// Model filter
-	if model := params.Get("modelLike"); model != "" {
-		query.ModelLike = &model
+	// Canonical provider filter, repeated values match any
+	for _, provider := range params["canonicalProvider"] {
+		if provider != "" {
+			query.CanonicalProviders = append(query.CanonicalProviders, provider)
+		}
+	}
+
+	// Model filter, repeated values match any
+	for _, model := range params["modelLike"] {
+		if model != "" {
+			query.ModelLike = append(query.ModelLike, model)
+		}
 	}
 
 	// URL filter
@@ -209,13 +746,114 @@ func (h *Handler) parseQuery(r *http.Request) (storage.Query, error) {
 		query.URLLike = &urlLike
 	}
 
-	// Status filter
-	if statusStr := params.Get("status"); statusStr != "" {
+	// Identical requests share a request hash
+	if requestHash := params.Get("requestHash"); requestHash != "" {
+		query.RequestHash = &requestHash
+	}
+
+	// Replays of a record
+	if replayOf := params.Get("replayOf"); replayOf != "" {
+		query.ReplayOf = &replayOf
+	}
+
+	if batch := params.Get("batch"); batch != "" {
+		query.Batch = &batch
+	}
+
+	// Pinned filter
+	if pinnedStr := params.Get("pinned"); pinnedStr != "" {
+		pinned, err := strconv.ParseBool(pinnedStr)
+		if err != nil {
+			return query, fmt.Errorf("invalid pinned parameter: %v", err)
+		}
+		query.Pinned = &pinned
+	}
+
+	// Tenant filter
+	if tenant := params.Get("tenant"); tenant != "" {
+		query.Tenant = &tenant
+	}
+
+	// Status filter, repeated values match any
+	for _, statusStr := range params["status"] {
+		if statusStr == "" {
+			continue
+		}
 		status, err := strconv.Atoi(statusStr)
 		if err != nil {
 			return query, fmt.Errorf("invalid status parameter: %v", err)
 		}
-		query.StatusEq = &status
+		query.Statuses = append(query.Statuses, status)
+	}
+
+	// Error type filter, repeated values match any
+	for _, errorType := range params["errorType"] {
+		if errorType != "" {
+			query.ErrorTypes = append(query.ErrorTypes, errorType)
+		}
+	}
+
+	// Kind filter, repeated values match any
+	for _, kind := range params["kind"] {
+		if kind != "" {
+			query.Kinds = append(query.Kinds, kind)
+		}
+	}
+
+	// Metadata filters, e.g. meta.team=nlp, repeated values match any
+	for name, values := range params {
+		key, ok := strings.CutPrefix(name, "meta.")
+		if !ok || key == "" {
+			continue
+		}
+		if query.Metadata == nil {
+			query.Metadata = make(map[string][]string)
+		}
+		query.Metadata[key] = append(query.Metadata[key], values...)
+	}
+
+	// Token filters
+	if minStr := params.Get("minTokens"); minStr != "" {
+		minTokens, err := strconv.Atoi(minStr)
+		if err != nil {
+			return query, fmt.Errorf("invalid minTokens parameter: %v", err)
+		}
+		query.MinTokens = &minTokens
+	}
+
+	if maxStr := params.Get("maxTokens"); maxStr != "" {
+		maxTokens, err := strconv.Atoi(maxStr)
+		if err != nil {
+			return query, fmt.Errorf("invalid maxTokens parameter: %v", err)
+		}
+		query.MaxTokens = &maxTokens
+	}
+
+	// Multiple choices (n > 1) filter
+	if multiStr := params.Get("multiChoice"); multiStr != "" {
+		multi, err := strconv.ParseBool(multiStr)
+		if err != nil {
+			return query, fmt.Errorf("invalid multiChoice parameter: %v", err)
+		}
+		query.MultiChoice = &multi
+	}
+
+	// Moderation filter
+	if filteredStr := params.Get("contentFiltered"); filteredStr != "" {
+		filtered, err := strconv.ParseBool(filteredStr)
+		if err != nil {
+			return query, fmt.Errorf("invalid contentFiltered parameter: %v", err)
+		}
+		query.ContentFiltered = &filtered
+	}
+
+	// Cache filter
+	if cacheStr := params.Get("cacheHit"); cacheStr != "" {
+		cacheHit, err := strconv.ParseBool(cacheStr)
+		if err != nil {
+			return query, fmt.Errorf("invalid cacheHit parameter: %v", err)
+		}
+		query.CacheHit = &cacheHit
 	}
 
 	// Text search
@@ -223,9 +861,10 @@ func (h *Handler) parseQuery(r *http.Request) (storage.Query, error) {
 		query.TextSearch = &q
 	}
 
-	// Time range filters
+	// Time range filters, absolute or relative to now
+	now := time.Now()
 	if fromStr := params.Get("from"); fromStr != "" {
-		from, err := time.Parse(time.RFC3339, fromStr)
+		from, err := parseTimeExpr(fromStr, now, false)
 		if err != nil {
 			return query, fmt.Errorf("invalid from parameter: %v", err)
 		}
@@ -233,7 +872,7 @@ func (h *Handler) parseQuery(r *http.Request) (storage.Query, error) {
 	}
 
 	if toStr := params.Get("to"); toStr != "" {
-		to, err := time.Parse(time.RFC3339, toStr)
+		to, err := parseTimeExpr(toStr, now, true)
 		if err != nil {
 			return query, fmt.Errorf("invalid to parameter: %v", err)
 		}
@@ -261,10 +900,10 @@ func (h *Handler) parseQuery(r *http.Request) (storage.Query, error) {
 
 	// Sort
 	if sort := params.Get("sort"); sort != "" {
-		if sort == "ts" || sort == "-ts" {
+		if storage.IsSortable(sort) {
 			query.Sort = sort
 		} else {
-			return query, fmt.Errorf("invalid sort parameter: must be 'ts' or '-ts'")
+			return query, fmt.Errorf("invalid sort parameter: must be ts, duration_ms, gateway_overhead_ms, content_chars or title, optionally prefixed with '-'")
 		}
 	}
 
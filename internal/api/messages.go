@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"openailogger/storage"
+)
+
+// conversationMessage is one turn of a normalized conversation
+type conversationMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	Name       string     `json:"name,omitempty"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// toolCall is a function call requested by the assistant
+type toolCall struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// handleMessages handles GET /api/requests/{id}/messages, returning the
+// conversation of a chat completions or responses API call, including the
+// assistant's reply
+func (h *Handler) handleMessages(w http.ResponseWriter, r *http.Request, id string) {
+	record, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Record not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get record: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	messages, ok := conversation(record)
+	if !ok {
+		http.Error(w, "Request body is not a recognized chat format", http.StatusUnprocessableEntity)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{"messages": messages})
+}
+
+// conversation normalizes the request messages and the reply of a chat
+// completions or responses API record
+func conversation(record *storage.Record) ([]conversationMessage, bool) {
+	var request struct {
+		Messages     []json.RawMessage `json:"messages"`
+		Instructions string            `json:"instructions"`
+		Input        json.RawMessage   `json:"input"`
+	}
+	if err := json.Unmarshal([]byte(record.RequestBody), &request); err != nil {
+		return nil, false
+	}
+
+	var messages []conversationMessage
+	switch {
+	case request.Messages != nil:
+		for _, raw := range request.Messages {
+			messages = append(messages, chatMessage(raw))
+		}
+	case request.Input != nil:
+		if request.Instructions != "" {
+			messages = append(messages, conversationMessage{Role: "system", Content: request.Instructions})
+		}
+		messages = append(messages, responsesInput(request.Input)...)
+	default:
+		return nil, false
+	}
+
+	return append(messages, replyMessages(record)...), true
+}
+
+// chatMessage normalizes a chat completions message
+func chatMessage(raw json.RawMessage) conversationMessage {
+	var message struct {
+		Role       string          `json:"role"`
+		Content    json.RawMessage `json:"content"`
+		Name       string          `json:"name"`
+		ToolCallID string          `json:"tool_call_id"`
+		ToolCalls  []struct {
+			ID       string `json:"id"`
+			Function struct {
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	}
+	json.Unmarshal(raw, &message)
+
+	normalized := conversationMessage{
+		Role:       message.Role,
+		Content:    contentText(message.Content),
+		Name:       message.Name,
+		ToolCallID: message.ToolCallID,
+	}
+	for _, call := range message.ToolCalls {
+		normalized.ToolCalls = append(normalized.ToolCalls, toolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	return normalized
+}
+
+// responsesInput normalizes the input of a responses API request, either a
+// plain string or a list of messages and function call items
+func responsesInput(raw json.RawMessage) []conversationMessage {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []conversationMessage{{Role: "user", Content: text}}
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil
+	}
+
+	var messages []conversationMessage
+	for _, item := range items {
+		messages = append(messages, responsesItem(item)...)
+	}
+	return messages
+}
+
+// responsesItem normalizes one input or output item of the responses API
+func responsesItem(raw json.RawMessage) []conversationMessage {
+	var item struct {
+		Type      string          `json:"type"`
+		Role      string          `json:"role"`
+		Content   json.RawMessage `json:"content"`
+		CallID    string          `json:"call_id"`
+		Name      string          `json:"name"`
+		Arguments string          `json:"arguments"`
+		Output    string          `json:"output"`
+	}
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return nil
+	}
+
+	switch item.Type {
+	case "function_call":
+		return []conversationMessage{{
+			Role:      "assistant",
+			ToolCalls: []toolCall{{ID: item.CallID, Name: item.Name, Arguments: item.Arguments}},
+		}}
+	case "function_call_output":
+		return []conversationMessage{{Role: "tool", Content: item.Output, ToolCallID: item.CallID}}
+	case "", "message":
+		return []conversationMessage{{Role: item.Role, Content: contentText(item.Content)}}
+	default:
+		return nil
+	}
+}
+
+// contentText flattens message content, a string or a list of parts, into
+// text. Non-text parts such as images are shown as a placeholder.
+func contentText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return ""
+	}
+
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text", "input_text", "output_text":
+			texts = append(texts, part.Text)
+		default:
+			texts = append(texts, "["+part.Type+"]")
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// replyMessages returns the assistant's reply of a record, empty when the
+// response isn't a recognized format
+func replyMessages(record *storage.Record) []conversationMessage {
+	if record.Stream {
+		if record.ReconstructedResponse == "" {
+			return nil
+		}
+		return []conversationMessage{{Role: "assistant", Content: record.ReconstructedResponse}}
+	}
+
+	var response struct {
+		Choices []struct {
+			Message json.RawMessage `json:"message"`
+		} `json:"choices"`
+		Output []json.RawMessage `json:"output"`
+	}
+	if err := json.Unmarshal([]byte(record.ResponseBody), &response); err != nil {
+		return nil
+	}
+
+	var messages []conversationMessage
+	if len(response.Choices) > 0 && response.Choices[0].Message != nil {
+		messages = append(messages, chatMessage(response.Choices[0].Message))
+	}
+	for _, item := range response.Output {
+		messages = append(messages, responsesItem(item)...)
+	}
+	return messages
+}
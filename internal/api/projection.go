@@ -0,0 +1,97 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"openailogger/storage"
+)
+
+// recordFields are the JSON names of the record fields exports can project
+var recordFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(storage.Record{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, ok := jsonField(t.Field(i)); ok {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// parseExportFields returns the record fields listed by the fields
+// parameter, comma-separated or repeated, or nil to export whole records
+func parseExportFields(r *http.Request) ([]string, error) {
+	var fields []string
+	seen := make(map[string]bool)
+	for _, v := range r.URL.Query()["fields"] {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[name] {
+				continue
+			}
+			if !recordFields[name] {
+				return nil, fmt.Errorf("unknown record field %q", name)
+			}
+			seen[name] = true
+			fields = append(fields, name)
+		}
+	}
+	return fields, nil
+}
+
+// projectRecord keeps only the given fields of an encoded record, in the
+// order they were requested. Fields the record omits stay omitted.
+func projectRecord(line []byte, fields []string) ([]byte, error) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode record: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, field := range fields {
+		value, ok := record[field]
+		if !ok {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// copyProjected copies an NDJSON export, projecting each record to fields
+func copyProjected(w io.Writer, r io.Reader, fields []string) error {
+	lines := bufio.NewReader(r)
+	for {
+		line, err := lines.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err // The partial line read is dropped
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			projected, perr := projectRecord(line, fields)
+			if perr != nil {
+				return perr
+			}
+			if _, werr := w.Write(append(projected, '\n')); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"openailogger/internal/proxy"
+	"openailogger/storage"
+)
+
+// idempotencyTTL is how long a replay idempotency key is remembered
+const idempotencyTTL = 10 * time.Minute
+
+// Replayer re-sends captured requests upstream
+type Replayer interface {
+	Replay(ctx context.Context, original *storage.Record, opts proxy.ReplayOptions) (*storage.Record, error)
+}
+
+// idempotentReplay tracks a replay started under an idempotency key. done is
+// closed once recordID or err is set, so concurrent repeats wait for it.
+type idempotentReplay struct {
+	done     chan struct{}
+	recordID string
+	err      error
+	expires  time.Time
+}
+
+// idempotencyCache remembers recent replay idempotency keys
+type idempotencyCache struct {
+	mu      sync.Mutex
+	replays map[string]*idempotentReplay
+}
+
+// claim returns the replay already registered for key, or registers a new
+// one and reports that the caller owns it
+func (c *idempotencyCache) claim(key string) (*idempotentReplay, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, replay := range c.replays {
+		if !replay.expires.IsZero() && now.After(replay.expires) {
+			delete(c.replays, k)
+		}
+	}
+
+	if replay, ok := c.replays[key]; ok {
+		return replay, false
+	}
+
+	if c.replays == nil {
+		c.replays = make(map[string]*idempotentReplay)
+	}
+	replay := &idempotentReplay{done: make(chan struct{})}
+	c.replays[key] = replay
+	return replay, true
+}
+
+// complete records the outcome of an owned replay. Failed replays are
+// forgotten so the key can be retried.
+func (c *idempotencyCache) complete(key string, replay *idempotentReplay, recordID string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	replay.recordID = recordID
+	replay.err = err
+	replay.expires = time.Now().Add(idempotencyTTL)
+	if err != nil {
+		delete(c.replays, key)
+	}
+	close(replay.done)
+}
+
+// handleReplay handles POST /api/requests/{id}/replay. An optional JSON
+// object body is merged into the original request body before sending.
+func (h *Handler) handleReplay(w http.ResponseWriter, r *http.Request, id string) {
+	if h.replayer == nil {
+		http.Error(w, "Replay not available", http.StatusNotImplemented)
+		return
+	}
+
+	overrides, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	opts := proxy.ReplayOptions{Header: r.Header}
+	if len(bytes.TrimSpace(overrides)) > 0 {
+		opts.Overrides = overrides
+	}
+
+	preserve := r.URL.Query().Get("preserveTimestamp") == "true"
+	if tsStr := r.URL.Query().Get("ts"); tsStr != "" {
+		if preserve {
+			http.Error(w, "Invalid query parameters: ts and preserveTimestamp are exclusive", http.StatusBadRequest)
+			return
+		}
+		ts, err := parseTimeExpr(tsStr, time.Now(), false)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid query parameters: invalid ts parameter: %v", err), http.StatusBadRequest)
+			return
+		}
+		opts.Timestamp = &ts
+	}
+
+	original, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Record not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get record: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+	if preserve {
+		opts.Timestamp = &original.Timestamp
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		record, err := h.replayer.Replay(r.Context(), original, opts)
+		if err != nil {
+			replayError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, record)
+		return
+	}
+
+	cacheKey := id + "\x00" + key
+	replay, owner := h.idempotency.claim(cacheKey)
+	if !owner {
+		// A replay with this key already ran or is running, return its record
+		select {
+		case <-replay.done:
+		case <-r.Context().Done():
+			return
+		}
+		if replay.err != nil {
+			replayError(w, replay.err)
+			return
+		}
+		record, err := h.store.Get(r.Context(), replay.recordID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get replay record: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeJSON(w, record)
+		return
+	}
+
+	// Detach from the client so an abandoned request still completes the
+	// replay that repeats are waiting on
+	record, err := h.replayer.Replay(context.WithoutCancel(r.Context()), original, opts)
+	if err != nil {
+		h.idempotency.complete(cacheKey, replay, "", err)
+		replayError(w, err)
+		return
+	}
+	h.idempotency.complete(cacheKey, replay, record.ID, nil)
+
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, record)
+}
+
+// replayError reports a failed replay, distinguishing bad overrides from
+// upstream failures
+func replayError(w http.ResponseWriter, err error) {
+	if errors.Is(err, proxy.ErrInvalidOverrides) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, proxy.ErrNotReplayable) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Failed to replay request: %v", err), http.StatusBadGateway)
+}
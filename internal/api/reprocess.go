@@ -0,0 +1,70 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"openailogger/storage"
+)
+
+// Reprocessor fills in the derived fields a stored record lacks
+type Reprocessor interface {
+	Reprocess(record *storage.Record)
+}
+
+// handleReprocess handles POST /api/reprocess, filling in the derived
+// fields missing from the records matching the query filters and updating
+// those that changed
+func (h *Handler) handleReprocess(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reprocessor, ok := h.replayer.(Reprocessor)
+	if !ok {
+		http.Error(w, "Reprocessing not available", http.StatusNotImplemented)
+		return
+	}
+
+	query, err := h.parseQuery(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query parameters: %v", err), http.StatusBadRequest)
+		return
+	}
+	query.Limit = 0
+	query.Offset = 0
+
+	records, total, err := h.store.List(r.Context(), query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list records: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Each record is reprocessed from its current version, so pins and
+	// notes edited meanwhile are kept
+	updated := 0
+	for _, listed := range records {
+		changed := false
+		_, err := storage.Modify(r.Context(), h.store, listed.ID, func(record *storage.Record) bool {
+			original := *record
+			reprocessor.Reprocess(record)
+			changed = !reflect.DeepEqual(original, *record)
+			return changed
+		})
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				continue // Deleted meanwhile
+			}
+			http.Error(w, fmt.Sprintf("Failed to update record: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if changed {
+			updated++
+		}
+	}
+
+	writeJSON(w, map[string]int{"matched": total, "updated": updated})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"openailogger/internal/proxy"
+	"openailogger/storage"
+)
+
+// routeHealth summarizes recent traffic for a configured route
+type routeHealth struct {
+	Name      string  `json:"name"`
+	Mount     string  `json:"mount"`
+	Upstream  string  `json:"upstream"`
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	P95MS     int64   `json:"p95_ms"`
+	// Upstreams holds the latest probe results when health checks are on
+	Upstreams []proxy.UpstreamStatus `json:"upstreams,omitempty"`
+}
+
+// HealthReporter provides the upstream probe results of a route
+type HealthReporter interface {
+	UpstreamHealth(route string) []proxy.UpstreamStatus
+}
+
+// handleRoutesHealth handles GET /api/routes/health
+func (h *Handler) handleRoutesHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := time.Hour
+	if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+		parsed, err := time.ParseDuration(windowStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid window parameter", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+	from := time.Now().Add(-window)
+
+	names := make([]string, 0, len(h.config.Routes))
+	for name := range h.config.Routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	routes := make([]routeHealth, 0, len(names))
+	for _, name := range names {
+		route := h.config.Routes[name]
+		records, _, err := h.store.List(r.Context(), storage.Query{
+			Providers: []string{name},
+			From:      &from,
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list records: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		health := routeHealth{
+			Name:     name,
+			Mount:    route.Mount,
+			Upstream: strings.Join(route.UpstreamURLs(), ", "),
+			Requests: len(records),
+		}
+
+		durations := make([]int64, 0, len(records))
+		for _, record := range records {
+			if isErrorRecord(&record) {
+				health.Errors++
+			}
+			durations = append(durations, record.DurationMS)
+		}
+		if health.Requests > 0 {
+			health.ErrorRate = float64(health.Errors) / float64(health.Requests)
+		}
+		health.P95MS = percentile(durations, 0.95)
+		if h.health != nil {
+			health.Upstreams = h.health.UpstreamHealth(name)
+		}
+
+		routes = append(routes, health)
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"window": window.String(),
+		"routes": routes,
+	})
+}
+
+// isErrorRecord reports whether a record represents a failed call
+func isErrorRecord(record *storage.Record) bool {
+	return record.Error != nil || record.Status == 0 || record.Status >= 400
+}
+
+// percentile returns the nearest-rank percentile of the values
+func percentile(values []int64, p float64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(p*float64(len(sorted))+0.999999) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
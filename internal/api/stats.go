@@ -0,0 +1,192 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"openailogger/storage"
+)
+
+// stats aggregates the records matching a query
+type stats struct {
+	Requests   int            `json:"requests"`
+	Errors     int            `json:"errors"`
+	ErrorRate  float64        `json:"error_rate"`
+	ErrorTypes map[string]int `json:"error_types"`
+	Tokens     storage.Usage  `json:"tokens"`
+	AvgMS      int64          `json:"avg_ms"`
+	P95MS      int64          `json:"p95_ms"`
+	// Responses answered from the response cache
+	CacheHits    int     `json:"cache_hits"`
+	CacheHitRate float64 `json:"cache_hit_rate"`
+	// Response sizes on the wire and decompressed, the latter only over
+	// the records whose decompressed size is known
+	ResponseBytes             int64 `json:"response_bytes"`
+	ResponseDecompressedBytes int64 `json:"response_decompressed_bytes"`
+	// Providers breaks requests and tokens down by canonical provider
+	Providers map[string]*providerStats `json:"providers"`
+}
+
+// providerStats aggregates the records of one canonical provider
+type providerStats struct {
+	Requests int           `json:"requests"`
+	Tokens   storage.Usage `json:"tokens"`
+}
+
+// handleStats handles GET /api/stats, aggregating the records matching the
+// usual query filters
+func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := h.parseQuery(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid query parameters: %v", err), http.StatusBadRequest)
+		return
+	}
+	query.Limit = 0
+	query.Offset = 0
+
+	records, _, err := h.store.List(r.Context(), query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list records: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	result := stats{
+		Requests:   len(records),
+		ErrorTypes: make(map[string]int),
+		Providers:  make(map[string]*providerStats),
+	}
+	durations := make([]int64, 0, len(records))
+	var totalMS int64
+	for i := range records {
+		record := &records[i]
+		if isErrorRecord(record) {
+			result.Errors++
+		}
+		if record.ErrorType != "" {
+			result.ErrorTypes[record.ErrorType]++
+		}
+		if record.CacheHit {
+			result.CacheHits++
+		}
+		// Records saved before canonical providers existed group by route
+		provider := record.CanonicalProvider
+		if provider == "" {
+			provider = record.Provider
+		}
+		if result.Providers[provider] == nil {
+			result.Providers[provider] = &providerStats{}
+		}
+		result.Providers[provider].Requests++
+		if record.Usage != nil {
+			addUsage(&result.Tokens, record.Usage)
+			addUsage(&result.Providers[provider].Tokens, record.Usage)
+		}
+		result.ResponseBytes += record.SizeResBytes
+		result.ResponseDecompressedBytes += record.SizeResDecompressedBytes
+		durations = append(durations, record.DurationMS)
+		totalMS += record.DurationMS
+	}
+	if result.Requests > 0 {
+		result.ErrorRate = float64(result.Errors) / float64(result.Requests)
+		result.AvgMS = totalMS / int64(result.Requests)
+		result.CacheHitRate = float64(result.CacheHits) / float64(result.Requests)
+	}
+	result.P95MS = percentile(durations, 0.95)
+
+	writeJSON(w, result)
+}
+
+// addUsage adds the token counts of u to total
+func addUsage(total *storage.Usage, u *storage.Usage) {
+	total.PromptTokens += u.PromptTokens
+	total.CompletionTokens += u.CompletionTokens
+	total.TotalTokens += u.TotalTokens
+}
+
+// sparklineInterval is the width of one sparkline bucket
+const sparklineInterval = time.Minute
+
+// sparklineMetrics maps a metric name to the value a record contributes to
+// its bucket
+var sparklineMetrics = map[string]func(*storage.Record) int64{
+	"count": func(*storage.Record) int64 { return 1 },
+	"errors": func(r *storage.Record) int64 {
+		if isErrorRecord(r) {
+			return 1
+		}
+		return 0
+	},
+	"tokens": func(r *storage.Record) int64 {
+		if r.Usage == nil {
+			return 0
+		}
+		return int64(r.Usage.TotalTokens)
+	},
+}
+
+// handleSparkline handles GET /api/stats/sparkline, returning per-minute
+// values of the last buckets minutes, oldest first, for status widgets
+func (h *Handler) handleSparkline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = "count"
+	}
+	value, ok := sparklineMetrics[metric]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid metric %q, expected count, errors or tokens", metric), http.StatusBadRequest)
+		return
+	}
+
+	buckets := 60
+	if bucketsStr := r.URL.Query().Get("buckets"); bucketsStr != "" {
+		parsed, err := strconv.Atoi(bucketsStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid buckets parameter", http.StatusBadRequest)
+			return
+		}
+		buckets = min(parsed, 1440)
+	}
+
+	end := time.Now().UTC().Truncate(sparklineInterval).Add(sparklineInterval)
+	start := end.Add(-time.Duration(buckets) * sparklineInterval)
+	records, _, err := h.store.List(r.Context(), storage.Query{From: &start})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list records: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"metric":   metric,
+		"interval": sparklineInterval.String(),
+		"start":    start,
+		"values":   bucketize(records, start, sparklineInterval, buckets, value),
+	})
+}
+
+// bucketize sums value over records into consecutive buckets of width
+// interval beginning at start. Records outside the range are ignored.
+func bucketize(records []storage.Record, start time.Time, interval time.Duration, buckets int, value func(*storage.Record) int64) []int64 {
+	values := make([]int64, buckets)
+	for i := range records {
+		offset := records[i].Timestamp.Sub(start)
+		if offset < 0 {
+			continue
+		}
+		if index := int(offset / interval); index < buckets {
+			values[index] += value(&records[i])
+		}
+	}
+	return values
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"openailogger/storage"
+)
+
+// handleThread handles GET /api/requests/{id}/thread, returning the replay
+// lineage of a record oldest first: the original it descends from and every
+// replay made from it or its replays
+func (h *Handler) handleThread(w http.ResponseWriter, r *http.Request, id string) {
+	record, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Record not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get record: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	root, err := h.threadRoot(r.Context(), record)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get record: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	thread, err := h.threadDescendants(r.Context(), root)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list records: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	sort.SliceStable(thread, func(i, j int) bool {
+		return thread[i].Timestamp.Before(thread[j].Timestamp)
+	})
+
+	writeJSON(w, map[string]interface{}{
+		"records": thread,
+		"total":   len(thread),
+	})
+}
+
+// threadRoot follows ReplayOf links up to the original record. Originals
+// that were deleted end the walk at the oldest surviving replay.
+func (h *Handler) threadRoot(ctx context.Context, record *storage.Record) (*storage.Record, error) {
+	seen := map[string]bool{record.ID: true}
+	for record.ReplayOf != "" && !seen[record.ReplayOf] {
+		parent, err := h.store.Get(ctx, record.ReplayOf)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				break
+			}
+			return nil, err
+		}
+		seen[parent.ID] = true
+		record = parent
+	}
+	return record, nil
+}
+
+// threadDescendants returns root and all records replayed from it,
+// directly or through other replays
+func (h *Handler) threadDescendants(ctx context.Context, root *storage.Record) ([]storage.Record, error) {
+	thread := []storage.Record{*root}
+	seen := map[string]bool{root.ID: true}
+
+	for i := 0; i < len(thread); i++ {
+		parentID := thread[i].ID
+		children, _, err := h.store.List(ctx, storage.Query{ReplayOf: &parentID})
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if !seen[child.ID] {
+				seen[child.ID] = true
+				thread = append(thread, child)
+			}
+		}
+	}
+	return thread, nil
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+
+	"openailogger/internal/config"
+)
+
+// Authenticator validates incoming proxy requests before they are forwarded
+type Authenticator interface {
+	// Authenticate returns the tenant ID the request belongs to, or an
+	// *AuthError describing how to reject it
+	Authenticate(r *http.Request, provider string) (string, error)
+}
+
+// AuthError rejects a request with the given HTTP status
+type AuthError struct {
+	Status  int
+	Message string
+}
+
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+// tokenAuthenticator maps static tokens from the config to tenants
+type tokenAuthenticator struct {
+	header string
+	tokens map[string]config.TenantConfig
+}
+
+// newTokenAuthenticator creates an authenticator from the auth config
+func newTokenAuthenticator(cfg config.AuthConfig) *tokenAuthenticator {
+	header := cfg.Header
+	if header == "" {
+		header = "X-Gateway-Token"
+	}
+	return &tokenAuthenticator{header: header, tokens: cfg.Tokens}
+}
+
+// Authenticate checks the token header and strips it so it never reaches
+// the upstream provider
+func (a *tokenAuthenticator) Authenticate(r *http.Request, provider string) (string, error) {
+	token := r.Header.Get(a.header)
+	r.Header.Del(a.header)
+
+	if token == "" {
+		return "", &AuthError{Status: http.StatusUnauthorized, Message: "Missing gateway token"}
+	}
+
+	tenant, ok := a.tokens[token]
+	if !ok {
+		return "", &AuthError{Status: http.StatusUnauthorized, Message: "Invalid gateway token"}
+	}
+
+	if len(tenant.Routes) > 0 && !slices.Contains(tenant.Routes, provider) {
+		return "", &AuthError{Status: http.StatusForbidden, Message: "Route not allowed for tenant"}
+	}
+
+	return tenant.Tenant, nil
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"openailogger/internal/config"
+)
+
+// weightedPicker spreads requests across upstreams with smooth weighted
+// round-robin, so a 70/30 split interleaves instead of sending bursts
+type weightedPicker struct {
+	mu      sync.Mutex
+	targets []config.UpstreamConfig
+	current []int
+	total   int
+	// sessions maps an affinity key to the index of its upstream, nil
+	// unless affinity is enabled
+	sessions    map[string]*stickySession
+	maxSessions int
+}
+
+// stickySession is the upstream a client is pinned to until expires
+type stickySession struct {
+	target  int
+	expires time.Time
+}
+
+// newWeightedPicker creates a picker over targets with positive weights
+func newWeightedPicker(targets []config.UpstreamConfig) *weightedPicker {
+	p := &weightedPicker{
+		targets: targets,
+		current: make([]int, len(targets)),
+	}
+	for _, target := range targets {
+		p.total += target.Weight
+	}
+	return p
+}
+
+// next returns the upstream that should serve the next request
+func (p *weightedPicker) next() config.UpstreamConfig {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.targets[p.advance()]
+}
+
+// sticky returns the upstream the session key is pinned to, pinning it to
+// the next one in rotation when it has none or it expired. Each request
+// extends the session by ttl. Once maxSessions are tracked, new keys are
+// balanced without being pinned.
+func (p *weightedPicker) sticky(key string, ttl time.Duration) config.UpstreamConfig {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	session, ok := p.sessions[key]
+	if ok && now.After(session.expires) {
+		delete(p.sessions, key)
+		ok = false
+	}
+	if !ok {
+		if len(p.sessions) >= p.maxSessions {
+			return p.targets[p.advance()]
+		}
+		session = &stickySession{target: p.advance()}
+		p.sessions[key] = session
+	}
+	session.expires = now.Add(ttl)
+	return p.targets[session.target]
+}
+
+// sweep forgets the expired sessions
+func (p *weightedPicker) sweep() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for key, session := range p.sessions {
+		if now.After(session.expires) {
+			delete(p.sessions, key)
+		}
+	}
+}
+
+// advance moves the rotation on and returns the index of the chosen
+// upstream. The caller must hold the lock.
+func (p *weightedPicker) advance() int {
+	best := 0
+	for i, target := range p.targets {
+		p.current[i] += target.Weight
+		if p.current[i] > p.current[best] {
+			best = i
+		}
+	}
+	p.current[best] -= p.total
+	return best
+}
+
+// pickUpstream returns the upstream for a request on the named route.
+// Routes with affinity keep a client on the same upstream, requests without
+// an affinity key are balanced as usual.
+func (g *Gateway) pickUpstream(name string, route config.RouteConfig, r *http.Request) config.UpstreamConfig {
+	picker, ok := g.balancers[name]
+	if !ok {
+		return route.Targets()[0]
+	}
+	if route.Affinity.Enabled {
+		if key := affinityKey(r, route.Affinity); key != "" {
+			return picker.sticky(key, route.Affinity.TTLDuration())
+		}
+	}
+	return picker.next()
+}
+
+// affinityKey identifies the session of a request by the configured header,
+// or by the client IP when no header is configured
+func affinityKey(r *http.Request, affinity config.AffinityConfig) string {
+	if affinity.Header != "" {
+		return r.Header.Get(affinity.Header)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
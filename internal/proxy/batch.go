@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"openailogger/storage"
+)
+
+// extractBatch recognizes Batch API traffic. Uploaded batch input files and
+// downloaded batch output files are replaced by their line count, and the
+// batch and file IDs are recorded so the upload, the batch creation and its
+// status polls can be found together.
+func (g *Gateway) extractBatch(record *storage.Record, contentType string) {
+	path := record.URL
+	if u, err := url.Parse(record.URL); err == nil {
+		path = u.Path
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	n := len(segments)
+
+	switch {
+	case record.Method == http.MethodPost && segments[n-1] == "files":
+		g.extractBatchUpload(record, contentType)
+	case record.Method == http.MethodPost && segments[n-1] == "batches":
+		var request struct {
+			InputFileID string `json:"input_file_id"`
+		}
+		if json.Unmarshal([]byte(record.RequestBody), &request) != nil || request.InputFileID == "" {
+			return
+		}
+		record.Kind = "batch"
+		record.BatchFileID = request.InputFileID
+		record.BatchID = responseID(record.ResponseBody)
+	case n >= 2 && segments[n-2] == "batches":
+		// Status polls, GET /batches/{id}, which link the output file once
+		// the batch completed
+		record.Kind = "batch"
+		record.BatchID = segments[n-1]
+		var response struct {
+			OutputFileID string `json:"output_file_id"`
+		}
+		if json.Unmarshal([]byte(record.ResponseBody), &response) == nil {
+			record.BatchFileID = response.OutputFileID
+		}
+	case n >= 3 && segments[n-3] == "batches" && segments[n-1] == "cancel":
+		record.Kind = "batch"
+		record.BatchID = segments[n-2]
+	case n >= 3 && segments[n-3] == "files" && segments[n-1] == "content":
+		// Batch output and error files are JSONL keyed by custom_id
+		if !strings.Contains(firstLine(record.ResponseBody), `"custom_id"`) {
+			return
+		}
+		record.Kind = "batch"
+		record.BatchFileID = segments[n-2]
+		record.BatchLines = countLines(record.ResponseBody)
+		record.ResponseBody = fmt.Sprintf("[batch file: %d lines, %d bytes omitted]", record.BatchLines, record.SizeResBytes)
+		record.ResponseChunks = nil
+	}
+}
+
+// batchUploadPlaceholder starts the request body stored for batch uploads
+const batchUploadPlaceholder = "[batch input file:"
+
+// extractBatchUpload replaces a multipart upload of a batch input file with
+// its line count and records the ID of the uploaded file
+func (g *Gateway) extractBatchUpload(record *storage.Record, contentType string) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		return
+	}
+
+	// A capture cut short by the cap only yields the lines read so far
+	reader := multipart.NewReader(strings.NewReader(record.RequestBody), params["boundary"])
+	purpose, lines, found := "", 0, false
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		var value bytes.Buffer
+		io.Copy(&value, part)
+		switch part.FormName() {
+		case "purpose":
+			purpose = value.String()
+		case "file":
+			lines, found = countLines(value.String()), true
+		}
+	}
+	if purpose != "batch" || !found {
+		return
+	}
+
+	record.Kind = "batch"
+	record.BatchFileID = responseID(record.ResponseBody)
+	if record.RequestTruncated {
+		// Leave batch_lines unset rather than report a partial count
+		record.RequestBody = fmt.Sprintf(batchUploadPlaceholder+" at least %d lines, %d bytes omitted]", lines, record.SizeReqBytes)
+		return
+	}
+	record.BatchLines = lines
+	record.RequestBody = fmt.Sprintf(batchUploadPlaceholder+" %d lines, %d bytes omitted]", lines, record.SizeReqBytes)
+}
+
+// responseID returns the id field of a JSON response
+func responseID(body string) string {
+	var response struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal([]byte(body), &response)
+	return response.ID
+}
+
+// firstLine returns s up to its first newline
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// countLines counts the non-empty lines of s
+func countLines(s string) int {
+	n := 0
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) != "" {
+			n++
+		}
+	}
+	return n
+}
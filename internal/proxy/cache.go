@@ -0,0 +1,235 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"openailogger/storage"
+)
+
+// cachedResponse is an upstream response kept for identical requests
+type cachedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// cacheEntry is a cached response, or a pending one while ready is open
+type cacheEntry struct {
+	ready   chan struct{}
+	resp    *cachedResponse
+	expires time.Time
+}
+
+// responseCache coalesces identical in-flight requests and keeps successful
+// responses for a TTL
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// newResponseCache creates an empty response cache
+func newResponseCache() *responseCache {
+	return &responseCache{entries: make(map[string]*cacheEntry)}
+}
+
+// lookup returns a fresh cached response for key. When there is none the
+// caller gets a cacheFill and is responsible for completing the entry;
+// requests arriving meanwhile wait for it. A nil response and nil fill
+// means the request should go upstream without caching.
+func (c *responseCache) lookup(ctx context.Context, key string) (*cachedResponse, *cacheFill) {
+	c.mu.Lock()
+	now := time.Now()
+	for k, entry := range c.entries {
+		if entry.resp != nil && now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cacheEntry{ready: make(chan struct{})}
+		c.entries[key] = entry
+		c.mu.Unlock()
+		return nil, &cacheFill{cache: c, key: key, entry: entry}
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+		return entry.resp, nil
+	case <-ctx.Done():
+		return nil, nil
+	}
+}
+
+// cacheFill records the upstream response of the request filling an entry
+type cacheFill struct {
+	cache    *responseCache
+	key      string
+	entry    *cacheEntry
+	recorder *cacheRecorder
+	finished bool
+}
+
+// wrap returns a writer that copies the response into the fill
+func (f *cacheFill) wrap(w http.ResponseWriter, maxBytes int64) http.ResponseWriter {
+	f.recorder = &cacheRecorder{ResponseWriter: w, body: cappedBuffer{maxSize: maxBytes}}
+	return f.recorder
+}
+
+// finish stores the response when it is cacheable and releases waiters.
+// Only complete, successful, non-streaming responses are cached.
+func (f *cacheFill) finish(record *storage.Record, ttl time.Duration) {
+	var resp *cachedResponse
+	if record != nil && f.recorder != nil {
+		body, truncated := f.recorder.body.contents()
+		status := f.recorder.status
+		if status >= 200 && status < 300 && !truncated && !record.Stream && record.Error == nil {
+			resp = &cachedResponse{
+				status: status,
+				header: f.recorder.Header().Clone(),
+				body:   []byte(body),
+			}
+		}
+	}
+
+	f.cache.mu.Lock()
+	defer f.cache.mu.Unlock()
+
+	if f.finished {
+		return
+	}
+	f.finished = true
+	f.entry.resp = resp
+	f.entry.expires = time.Now().Add(ttl)
+	if resp == nil {
+		delete(f.cache.entries, f.key)
+	}
+	close(f.entry.ready)
+}
+
+// abandon releases waiters without caching anything, unless the fill was
+// already finished. Deferred so an aborted proxy never leaves waiters hanging.
+func (f *cacheFill) abandon() {
+	f.finish(nil, 0)
+}
+
+// cacheRecorder copies everything written to the client
+type cacheRecorder struct {
+	http.ResponseWriter
+	status int
+	body   cappedBuffer
+}
+
+func (cr *cacheRecorder) WriteHeader(status int) {
+	if cr.status == 0 {
+		cr.status = status
+	}
+	cr.ResponseWriter.WriteHeader(status)
+}
+
+func (cr *cacheRecorder) Write(p []byte) (int, error) {
+	if cr.status == 0 {
+		cr.status = http.StatusOK
+	}
+	cr.body.Write(p)
+	return cr.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush
+func (cr *cacheRecorder) Unwrap() http.ResponseWriter {
+	return cr.ResponseWriter
+}
+
+// credentialHeaders carry the upstream credentials a cached response must
+// not be shared across
+var credentialHeaders = []string{"Authorization", "Api-Key", "X-Api-Key"}
+
+// requestCacheKey identifies identical requests of the same tenant and
+// credentials, ignoring key order and whitespace in JSON bodies as well as
+// the ignored fields. The stored request hash used for deduplication still
+// covers the whole body and nothing else.
+func requestCacheKey(record *storage.Record, header http.Header, ignoreFields []string) string {
+	h := sha256.New()
+	h.Write([]byte(requestBodyKey(record, ignoreFields)))
+	h.Write([]byte{0})
+	h.Write([]byte(record.TenantID))
+	for _, name := range credentialHeaders {
+		h.Write([]byte{0})
+		for _, value := range header.Values(name) {
+			h.Write([]byte(value))
+			h.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// requestBodyKey hashes the request with the ignored fields removed from
+// its JSON body
+func requestBodyKey(record *storage.Record, ignoreFields []string) string {
+	if len(ignoreFields) == 0 {
+		return storage.RequestHash(record)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(record.RequestBody), &doc); err != nil {
+		return storage.RequestHash(record)
+	}
+	for _, field := range ignoreFields {
+		deletePath(doc, strings.Split(field, "."))
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return storage.RequestHash(record)
+	}
+
+	normalized := *record
+	normalized.RequestBody = string(body)
+	return storage.RequestHash(&normalized)
+}
+
+// deletePath removes the object key at path inside doc, descending into
+// array elements by index. Missing paths are ignored.
+func deletePath(doc interface{}, path []string) {
+	key := path[0]
+	last := len(path) == 1
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if last {
+			delete(node, key)
+		} else if child, ok := node[key]; ok {
+			deletePath(child, path[1:])
+		}
+	case []interface{}:
+		index, err := strconv.Atoi(key)
+		if err == nil && index >= 0 && index < len(node) && !last {
+			deletePath(node[index], path[1:])
+		}
+	}
+}
+
+// writeCached answers a request from the cache and fills in the record
+func writeCached(w http.ResponseWriter, record *storage.Record, cached *cachedResponse) {
+	for name, values := range cached.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.Header().Set("X-Capture-Cache", "HIT")
+	w.WriteHeader(cached.status)
+	w.Write(cached.body)
+
+	record.Status = cached.status
+	record.ResponseCharset = contentCharset(cached.header.Get("Content-Type"))
+	record.ResponseEncoding = cached.header.Get("Content-Encoding")
+	record.ResponseBody = string(cached.body)
+	record.SizeResBytes = int64(len(cached.body))
+	record.CacheHit = true
+}
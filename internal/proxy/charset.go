@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"openailogger/storage"
+)
+
+// contentCharset returns the lowercased charset parameter of a Content-Type
+// header, empty when none is declared
+func contentCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(params["charset"])
+}
+
+// transcodeBodies converts captured bodies declared as Latin-1 to UTF-8 so
+// they render correctly. Other non-UTF-8 charsets are stored as received,
+// the charset fields tell readers how to decode them.
+func (g *Gateway) transcodeBodies(record *storage.Record) {
+	if isLatin1(record.RequestCharset) {
+		record.RequestBody = latin1ToUTF8(record.RequestBody)
+	}
+	if isLatin1(record.ResponseCharset) {
+		record.ResponseBody = latin1ToUTF8(record.ResponseBody)
+		record.RewrittenResponse = latin1ToUTF8(record.RewrittenResponse)
+		for i := range record.ResponseChunks {
+			record.ResponseChunks[i] = latin1ToUTF8(record.ResponseChunks[i])
+		}
+	}
+}
+
+// isLatin1 reports whether charset names ISO-8859-1
+func isLatin1(charset string) bool {
+	switch charset {
+	case "iso-8859-1", "iso8859-1", "latin1", "l1":
+		return true
+	}
+	return false
+}
+
+// latin1ToUTF8 maps every byte of s to the code point of the same value
+func latin1ToUTF8(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] < utf8.RuneSelf {
+			b.WriteByte(s[i])
+		} else {
+			b.WriteRune(rune(s[i]))
+		}
+	}
+	return b.String()
+}
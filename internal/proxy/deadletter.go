@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"openailogger/storage"
+)
+
+// DeadLetter is a record the store failed to save
+type DeadLetter struct {
+	Record   storage.Record `json:"record"`
+	Error    string         `json:"error"`
+	FailedAt time.Time      `json:"failed_at"`
+}
+
+// deadLetters keeps the latest records that failed to save, oldest first,
+// dropping the oldest once max is reached
+type deadLetters struct {
+	mu      sync.Mutex
+	entries []DeadLetter
+	max     int
+}
+
+// add keeps a record that failed to save
+func (d *deadLetters) add(record *storage.Record, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries = append(d.entries, DeadLetter{Record: *record, Error: err.Error(), FailedAt: time.Now().UTC()})
+	if len(d.entries) > d.max {
+		d.entries = d.entries[len(d.entries)-d.max:]
+	}
+}
+
+// list returns a copy of the dead letters
+func (d *deadLetters) list() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DeadLetter(nil), d.entries...)
+}
+
+// take removes and returns all dead letters
+func (d *deadLetters) take() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries := d.entries
+	d.entries = nil
+	return entries
+}
+
+// DeadLetters returns the records the store failed to save, oldest first
+func (g *Gateway) DeadLetters() []DeadLetter {
+	return g.dead.list()
+}
+
+// RetryDeadLetters tries saving the dead-lettered records again. Records
+// that fail again stay dead-lettered with the new error.
+func (g *Gateway) RetryDeadLetters(ctx context.Context) (saved, failed int) {
+	for _, entry := range g.dead.take() {
+		record := entry.Record
+		if err := g.store.Save(ctx, &record); err != nil {
+			g.dead.add(&record, err)
+			failed++
+			continue
+		}
+		g.publish(&record)
+		saved++
+	}
+	return saved, failed
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+
+	"openailogger/storage"
+)
+
+// maxDecompressedBytes bounds how much of a compressed body is inflated to
+// measure it, which happens on the request path, guarding against slow
+// responses and decompression bombs
+const maxDecompressedBytes = 32 << 20
+
+// measureDecompressed sets the decompressed size of the response. It equals
+// the wire size without compression, and stays unknown (0) for encodings
+// that can't be inflated here, captures cut short by the cap and bodies
+// inflating past maxDecompressedBytes.
+func (g *Gateway) measureDecompressed(record *storage.Record) {
+	encoding := strings.ToLower(strings.TrimSpace(record.ResponseEncoding))
+	if encoding == "" || encoding == "identity" {
+		record.SizeResDecompressedBytes = record.SizeResBytes
+		return
+	}
+	if int64(len(record.ResponseBody)) != record.SizeResBytes {
+		return
+	}
+
+	var reader io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(strings.NewReader(record.ResponseBody))
+	case "deflate":
+		reader, err = zlib.NewReader(strings.NewReader(record.ResponseBody))
+	default:
+		return
+	}
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+
+	// One byte past the bound tells it was reached
+	n, err := io.Copy(io.Discard, io.LimitReader(reader, maxDecompressedBytes+1))
+	if err != nil || n > maxDecompressedBytes {
+		return
+	}
+	record.SizeResDecompressedBytes = n
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"openailogger/internal/config"
+	"openailogger/storage"
+)
+
+func TestMeasureDecompressed(t *testing.T) {
+	gzipped := func(n int) string {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(make([]byte, n))
+		w.Close()
+		return buf.String()
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     string
+		want     int64
+	}{
+		{"identity", "", "{}", 2},
+		{"gzip", "gzip", gzipped(4096), 4096},
+		{"at the bound", "gzip", gzipped(maxDecompressedBytes), maxDecompressedBytes},
+		{"past the bound", "gzip", gzipped(maxDecompressedBytes + 1), 0},
+		{"unsupported encoding", "br", "\x0b\x00\x80", 0},
+	}
+
+	g := &Gateway{config: &config.Config{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := &storage.Record{
+				ResponseEncoding: tt.encoding,
+				ResponseBody:     tt.body,
+				SizeResBytes:     int64(len(tt.body)),
+			}
+			g.measureDecompressed(record)
+			if record.SizeResDecompressedBytes != tt.want {
+				t.Errorf("SizeResDecompressedBytes = %d, want %d", record.SizeResDecompressedBytes, tt.want)
+			}
+		})
+	}
+}
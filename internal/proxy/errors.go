@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// classifyError maps a failed upstream exchange to an error type so
+// failures can be aggregated by category
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "client_canceled"
+	case errors.As(err, &dnsErr):
+		return "dns_failure"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "upstream_timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection_reset"
+	default:
+		return "upstream_error"
+	}
+}
+
+// classifyStatus returns the error type of an upstream error status, empty
+// for successful responses
+func classifyStatus(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return "rate_limited"
+	case status >= 500:
+		return "upstream_5xx"
+	case status >= 400:
+		return "upstream_4xx"
+	default:
+		return ""
+	}
+}
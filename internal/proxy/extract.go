@@ -0,0 +1,506 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"mime"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"openailogger/storage"
+)
+
+// extractModelHint attempts to extract model information from request body
+func (g *Gateway) extractModelHint(record *storage.Record) {
+	if record.RequestBody == "" {
+		return
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(record.RequestBody), &data); err != nil {
+		return
+	}
+
+	if model, ok := data["model"].(string); ok {
+		record.ModelHint = model
+	}
+}
+
+// extractTitle stores the value at the route's title_field in the JSON
+// request body as the record's title. Non-string values are kept as JSON.
+func (g *Gateway) extractTitle(record *storage.Record) {
+	field := g.config.Routes[record.Provider].TitleField
+	if field == "" || record.RequestBody == "" {
+		return
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal([]byte(record.RequestBody), &doc); err != nil {
+		return
+	}
+	value, ok := lookupPath(doc, strings.Split(field, "."))
+	if !ok || value == nil {
+		return
+	}
+
+	if title, ok := value.(string); ok {
+		record.Title = title
+		return
+	}
+	if title, err := json.Marshal(value); err == nil {
+		record.Title = string(title)
+	}
+}
+
+// lookupPath returns the value at path inside doc, descending into array
+// elements by index
+func lookupPath(doc interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			child, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			doc = child
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			doc = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// kindPaths classifies requests by path suffix across provider path
+// differences, most specific first
+var kindPaths = []struct {
+	suffix string
+	kind   string
+}{
+	{"/chat/completions", "chat"},
+	{"/responses", "chat"},
+	{"/messages", "chat"},
+	{"/api/chat", "chat"},
+	{"/completions", "completion"},
+	{"/api/generate", "completion"},
+	{"/embeddings", "embedding"},
+	{"/api/embed", "embedding"},
+	{"/moderations", "moderation"},
+}
+
+// extractKind classifies the request as chat, completion, embedding,
+// image, audio, moderation or other, from its path and otherwise from the
+// shape of its body. Batch API traffic is classified by extractBatch.
+func (g *Gateway) extractKind(record *storage.Record) {
+	if record.BatchID != "" || record.BatchFileID != "" {
+		record.Kind = "batch" // Reprocessed, its batch bodies are gone
+		return
+	}
+	record.Kind = "other"
+
+	path := record.URL
+	if u, err := url.Parse(record.URL); err == nil {
+		path = u.Path
+	}
+	path = strings.TrimSuffix(path, "/")
+	switch {
+	case strings.Contains(path, "/images/"):
+		record.Kind = "image"
+		return
+	case strings.Contains(path, "/audio/"):
+		record.Kind = "audio"
+		return
+	}
+	for _, p := range kindPaths {
+		if strings.HasSuffix(path, p.suffix) {
+			record.Kind = p.kind
+			return
+		}
+	}
+
+	var body map[string]json.RawMessage
+	if json.Unmarshal([]byte(record.RequestBody), &body) != nil {
+		return
+	}
+	switch {
+	case body["messages"] != nil:
+		record.Kind = "chat"
+	case body["prompt"] != nil:
+		record.Kind = "completion"
+	}
+}
+
+// extractForm decodes form-encoded request bodies into structured fields
+func (g *Gateway) extractForm(record *storage.Record, contentType string) {
+	if record.RequestBody == "" {
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return
+	}
+
+	form, err := url.ParseQuery(record.RequestBody)
+	if err != nil {
+		return
+	}
+
+	record.RequestForm = form
+}
+
+// extractUsage attempts to extract token usage from the response body. In
+// streams requested with stream_options.include_usage, OpenAI sends it in a
+// final chunk with empty choices just before [DONE]; every other chunk
+// carries "usage": null.
+func (g *Gateway) extractUsage(record *storage.Record) {
+	if record.ResponseBody == "" {
+		return
+	}
+
+	payloads := []string{record.ResponseBody}
+	if record.Stream {
+		payloads = sseData(record.ResponseBody)
+	}
+
+	var usage *storage.Usage
+	for _, payload := range payloads {
+		var data struct {
+			Usage *storage.Usage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(payload), &data); err != nil || data.Usage == nil {
+			continue
+		}
+		usage = data.Usage
+	}
+
+	if usage != nil && usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	record.Usage = usage
+}
+
+// extractChoices records how many choices the response carries and their
+// finish reasons and tool calls, across all choices rather than just the
+// first. Requests with n > 1 are disproportionately expensive.
+func (g *Gateway) extractChoices(record *storage.Record) {
+	var request struct {
+		N int `json:"n"`
+	}
+	if err := json.Unmarshal([]byte(record.RequestBody), &request); err == nil && request.N > 1 {
+		record.ChoiceCount = request.N
+	}
+
+	type choice struct {
+		Index        int     `json:"index"`
+		FinishReason *string `json:"finish_reason"`
+		Text         string  `json:"text"`
+		Message      struct {
+			Content   json.RawMessage   `json:"content"`
+			ToolCalls []json.RawMessage `json:"tool_calls"`
+		} `json:"message"`
+		Delta struct {
+			Content   json.RawMessage `json:"content"`
+			ToolCalls []struct {
+				Index int `json:"index"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	}
+
+	finishReasons := make(map[int]string)
+	toolCalls := make(map[[2]int]bool)
+	choices := make(map[int]bool)
+	chars := 0
+
+	collect := func(payload string) {
+		var response struct {
+			Choices []choice `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(payload), &response); err != nil {
+			return
+		}
+		for _, c := range response.Choices {
+			choices[c.Index] = true
+			if c.FinishReason != nil && *c.FinishReason != "" {
+				finishReasons[c.Index] = *c.FinishReason
+			}
+			chars += textChars(c.Message.Content) + textChars(c.Delta.Content) + utf8.RuneCountInString(c.Text)
+			for i := range c.Message.ToolCalls {
+				toolCalls[[2]int{c.Index, i}] = true
+			}
+			for _, call := range c.Delta.ToolCalls {
+				toolCalls[[2]int{c.Index, call.Index}] = true
+			}
+		}
+	}
+
+	if record.Stream {
+		for _, payload := range sseData(record.ResponseBody) {
+			collect(payload)
+		}
+	} else {
+		collect(record.ResponseBody)
+	}
+
+	if len(choices) > record.ChoiceCount {
+		record.ChoiceCount = len(choices)
+	}
+	record.ToolCallCount = len(toolCalls)
+	if g.config.Capture.ContentBreakdown {
+		record.ContentChars = chars
+	}
+
+	record.FinishReasons = nil
+	for index := 0; index < record.ChoiceCount; index++ {
+		if reason, ok := finishReasons[index]; ok {
+			record.FinishReasons = append(record.FinishReasons, reason)
+		}
+	}
+}
+
+// textChars counts the characters of a JSON string, 0 for null or content
+// that isn't plain text
+func textChars(raw json.RawMessage) int {
+	var text string
+	if json.Unmarshal(raw, &text) != nil {
+		return 0
+	}
+	return utf8.RuneCountInString(text)
+}
+
+// extractContentFilter summarizes content-filter annotations such as Azure
+// OpenAI's prompt_filter_results and per-choice content_filter_results,
+// collecting the categories that were filtered or detected
+func (g *Gateway) extractContentFilter(record *storage.Record) {
+	type categories map[string]struct {
+		Filtered bool `json:"filtered"`
+		Detected bool `json:"detected"`
+	}
+
+	flagged := make(map[string]bool)
+	filtered := false
+	collectCategories := func(results categories) {
+		for name, result := range results {
+			if result.Filtered || result.Detected {
+				flagged[name] = true
+			}
+			filtered = filtered || result.Filtered
+		}
+	}
+
+	collect := func(payload string) {
+		var response struct {
+			PromptFilterResults []struct {
+				ContentFilterResults categories `json:"content_filter_results"`
+			} `json:"prompt_filter_results"`
+			Choices []struct {
+				FinishReason         string     `json:"finish_reason"`
+				ContentFilterResults categories `json:"content_filter_results"`
+			} `json:"choices"`
+			Error *struct {
+				Code       string `json:"code"`
+				InnerError struct {
+					ContentFilterResult categories `json:"content_filter_result"`
+				} `json:"innererror"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(payload), &response); err != nil {
+			return
+		}
+
+		for _, prompt := range response.PromptFilterResults {
+			collectCategories(prompt.ContentFilterResults)
+		}
+		for _, c := range response.Choices {
+			collectCategories(c.ContentFilterResults)
+			filtered = filtered || c.FinishReason == "content_filter"
+		}
+		if response.Error != nil {
+			collectCategories(response.Error.InnerError.ContentFilterResult)
+			filtered = filtered || response.Error.Code == "content_filter"
+		}
+	}
+
+	if record.Stream {
+		for _, payload := range sseData(record.ResponseBody) {
+			collect(payload)
+		}
+	} else {
+		collect(record.ResponseBody)
+	}
+
+	record.ContentFiltered = filtered
+	record.FilterCategories = nil
+	for name := range flagged {
+		record.FilterCategories = append(record.FilterCategories, name)
+	}
+	sort.Strings(record.FilterCategories)
+}
+
+// extractReconstruction assembles the text of a streamed response from its
+// content deltas, or the text fragments of legacy /completions streams.
+// Payloads that aren't valid JSON, e.g. a chunk cut short by the capture
+// cap, are skipped and the record is marked partial instead of losing the
+// whole reconstruction.
+func (g *Gateway) extractReconstruction(record *storage.Record) {
+	if !record.Stream || record.ResponseBody == "" {
+		return
+	}
+	if isTranscriptionURL(record.URL) {
+		extractTranscript(record)
+		return
+	}
+
+	contents := make(map[int]*strings.Builder)
+	partial := false
+	for _, payload := range sseData(record.ResponseBody) {
+		var chunk struct {
+			Choices []struct {
+				Index int    `json:"index"`
+				Text  string `json:"text"`
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			partial = true
+			continue
+		}
+
+		for _, c := range chunk.Choices {
+			if contents[c.Index] == nil {
+				contents[c.Index] = &strings.Builder{}
+			}
+			contents[c.Index].WriteString(c.Delta.Content)
+			contents[c.Index].WriteString(c.Text)
+		}
+	}
+
+	indexes := make([]int, 0, len(contents))
+	for index := range contents {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	// Choices of n > 1 requests are separated by a blank line
+	texts := make([]string, len(indexes))
+	for i, index := range indexes {
+		texts[i] = contents[index].String()
+	}
+	record.ReconstructedResponse = strings.Join(texts, "\n\n")
+	record.ReconstructionPartial = partial
+}
+
+// isTranscriptionURL reports whether a request URL targets the audio
+// transcription endpoint
+func isTranscriptionURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), "/audio/transcriptions")
+}
+
+// extractTranscript assembles the transcript of a streamed transcription
+// from its transcript.text.delta events. The final transcript.text.done
+// event carries the whole text and takes precedence when it was captured.
+func extractTranscript(record *storage.Record) {
+	var text strings.Builder
+	final, done, partial := "", false, false
+	for _, payload := range sseData(record.ResponseBody) {
+		var event struct {
+			Type  string `json:"type"`
+			Delta string `json:"delta"`
+			Text  string `json:"text"`
+		}
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			partial = true
+			continue
+		}
+
+		switch event.Type {
+		case "transcript.text.delta":
+			text.WriteString(event.Delta)
+		case "transcript.text.done":
+			final, done = event.Text, true
+		}
+	}
+
+	record.ReconstructedResponse = text.String()
+	if done {
+		record.ReconstructedResponse = final
+		partial = false
+	}
+	record.ReconstructionPartial = partial
+}
+
+// extractEventTypes counts the events of a server-sent event stream by type.
+// Events without an event field have the SSE default type "message", as in
+// OpenAI streams, while e.g. Anthropic names every event.
+func (g *Gateway) extractEventTypes(record *storage.Record) {
+	if !record.Stream || record.ResponseBody == "" {
+		return
+	}
+
+	counts := make(map[string]int)
+	eventType, pending := "", false
+	dispatch := func() {
+		if pending {
+			if eventType == "" {
+				eventType = "message"
+			}
+			counts[eventType]++
+		}
+		eventType, pending = "", false
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(record.ResponseBody))
+	scanner.Buffer(make([]byte, 64*1024), len(record.ResponseBody)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case line == "":
+			dispatch()
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			pending = true
+		case strings.HasPrefix(line, "data:"):
+			pending = true
+		}
+	}
+	dispatch()
+
+	if len(counts) > 0 {
+		record.EventTypeCounts = counts
+	}
+}
+
+// sseData returns the data payloads of a server-sent event stream
+func sseData(body string) []string {
+	var payloads []string
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+		payloads = append(payloads, data)
+	}
+
+	return payloads
+}
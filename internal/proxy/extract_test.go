@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"openailogger/internal/config"
+	"openailogger/storage"
+)
+
+// fixture returns the contents of a file under testdata
+func fixture(t *testing.T, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return string(data)
+}
+
+func TestLegacyCompletionsExtraction(t *testing.T) {
+	tests := []struct {
+		name          string
+		fixture       string
+		stream        bool
+		reconstructed string
+		finishReasons []string
+		contentChars  int
+	}{
+		{
+			name:          "non-streaming",
+			fixture:       "completions_legacy.json",
+			finishReasons: []string{"stop"},
+			contentChars:  33,
+		},
+		{
+			name:          "streaming",
+			fixture:       "completions_legacy_stream.txt",
+			stream:        true,
+			reconstructed: "\n\nThe capital of France is Paris.",
+			finishReasons: []string{"length"},
+			contentChars:  33,
+		},
+	}
+
+	cfg := &config.Config{}
+	cfg.Capture.ContentBreakdown = true
+	g := &Gateway{config: cfg}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := &storage.Record{
+				URL:          "/openai/v1/completions",
+				RequestBody:  `{"model":"gpt-3.5-turbo-instruct","prompt":"The capital of France is"}`,
+				ResponseBody: fixture(t, tt.fixture),
+				Stream:       tt.stream,
+			}
+			g.extractChoices(record)
+			g.extractReconstruction(record)
+
+			if record.ReconstructedResponse != tt.reconstructed {
+				t.Errorf("ReconstructedResponse = %q, want %q", record.ReconstructedResponse, tt.reconstructed)
+			}
+			if record.ReconstructionPartial {
+				t.Error("ReconstructionPartial = true, want false")
+			}
+			if !reflect.DeepEqual(record.FinishReasons, tt.finishReasons) {
+				t.Errorf("FinishReasons = %v, want %v", record.FinishReasons, tt.finishReasons)
+			}
+			if record.ChoiceCount != 1 {
+				t.Errorf("ChoiceCount = %d, want 1", record.ChoiceCount)
+			}
+			if record.ContentChars != tt.contentChars {
+				t.Errorf("ContentChars = %d, want %d", record.ContentChars, tt.contentChars)
+			}
+		})
+	}
+}
+
+func TestStreamingUsage(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		stream bool
+		want   *storage.Usage
+	}{
+		{
+			name:   "include_usage final chunk",
+			body:   fixture(t, "chat_stream_usage.txt"),
+			stream: true,
+			want:   &storage.Usage{PromptTokens: 9, CompletionTokens: 2, TotalTokens: 11},
+		},
+		{
+			name:   "stream without usage",
+			body:   "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}],\"usage\":null}\n\ndata: [DONE]\n\n",
+			stream: true,
+		},
+		{
+			name: "non-streaming",
+			body: `{"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":4}}`,
+			want: &storage.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
+		},
+	}
+
+	g := &Gateway{config: &config.Config{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := &storage.Record{ResponseBody: tt.body, Stream: tt.stream}
+			g.extractUsage(record)
+			if !reflect.DeepEqual(record.Usage, tt.want) {
+				t.Errorf("Usage = %+v, want %+v", record.Usage, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTranscriptionURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"/openai/v1/audio/transcriptions", true},
+		{"/openai/v1/audio/transcriptions/", true},
+		{"/openai/v1/audio/transcriptions?stream=true", true},
+		{"/openai/v1/audio/translations", false},
+		{"/openai/v1/audio/speech", false},
+		{"/openai/v1/chat/completions", false},
+	}
+
+	for _, tt := range tests {
+		if got := isTranscriptionURL(tt.url); got != tt.want {
+			t.Errorf("isTranscriptionURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestTranscriptReconstruction(t *testing.T) {
+	stream := fixture(t, "transcription_stream.txt")
+	deltas := stream[:strings.Index(stream, "data: {\"type\":\"transcript.text.done\"")]
+
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		partial bool
+	}{
+		{"done event", stream, "The quick brown fox.", false},
+		{"deltas only", deltas, "The quick brown fox.", false},
+		{"cut short", deltas + "data: {\"type\":\"transcript.te", "The quick brown fox.", true},
+	}
+
+	g := &Gateway{config: &config.Config{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := &storage.Record{
+				URL:          "/openai/v1/audio/transcriptions",
+				ResponseBody: tt.body,
+				Stream:       true,
+			}
+			g.extractReconstruction(record)
+			if record.ReconstructedResponse != tt.want {
+				t.Errorf("ReconstructedResponse = %q, want %q", record.ReconstructedResponse, tt.want)
+			}
+			if record.ReconstructionPartial != tt.partial {
+				t.Errorf("ReconstructionPartial = %v, want %v", record.ReconstructionPartial, tt.partial)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"openailogger/internal/config"
+	"openailogger/storage/faultstore"
+	"openailogger/storage/memory"
+)
+
+// okUpstream answers every request with an empty JSON object
+var okUpstream = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("{}"))
+})
+
+func TestFailedSavesAreDeadLettered(t *testing.T) {
+	store := faultstore.New(memory.New())
+	store.FailNext(1)
+	g, server := newTestGateway(t, &config.Config{}, store, okUpstream)
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/test/v1/models", nil)
+		do(t, req)
+	}
+
+	if records := storedRecords(t, g); len(records) != 1 {
+		t.Fatalf("got %d stored records, want 1", len(records))
+	}
+	dead := g.DeadLetters()
+	if len(dead) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(dead))
+	}
+	if dead[0].Error != faultstore.ErrInjected.Error() {
+		t.Errorf("dead letter error = %q, want %q", dead[0].Error, faultstore.ErrInjected)
+	}
+
+	saved, failed := g.RetryDeadLetters(context.Background())
+	if saved != 1 || failed != 0 {
+		t.Errorf("RetryDeadLetters = %d saved, %d failed, want 1 and 0", saved, failed)
+	}
+	if records := storedRecords(t, g); len(records) != 2 {
+		t.Errorf("got %d stored records after retry, want 2", len(records))
+	}
+	if dead := g.DeadLetters(); len(dead) != 0 {
+		t.Errorf("got %d dead letters after retry, want 0", len(dead))
+	}
+}
+
+func TestRetryKeepsFailingDeadLetters(t *testing.T) {
+	store := faultstore.New(memory.New())
+	store.SetFailureRate(1, 0)
+	g, server := newTestGateway(t, &config.Config{}, store, okUpstream)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/test/v1/models", nil)
+	do(t, req)
+	storedRecords(t, g)
+
+	saved, failed := g.RetryDeadLetters(context.Background())
+	if saved != 0 || failed != 1 {
+		t.Errorf("RetryDeadLetters = %d saved, %d failed, want 0 and 1", saved, failed)
+	}
+	if dead := g.DeadLetters(); len(dead) != 1 {
+		t.Errorf("got %d dead letters, want the record kept", len(dead))
+	}
+}
+
+func TestSlowStoreDoesNotDelayResponses(t *testing.T) {
+	const latency = 500 * time.Millisecond
+	store := faultstore.New(memory.New())
+	store.SetLatency(latency)
+	g, server := newTestGateway(t, &config.Config{}, store, okUpstream)
+
+	start := time.Now()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/test/v1/models", nil)
+	do(t, req)
+	if elapsed := time.Since(start); elapsed >= latency {
+		t.Errorf("response took %v, want it answered before the %v save", elapsed, latency)
+	}
+
+	if records := storedRecords(t, g); len(records) != 1 {
+		t.Errorf("got %d stored records, want 1 once saved", len(records))
+	}
+}
+
+func TestFlushDrainsSlowStore(t *testing.T) {
+	store := faultstore.New(memory.New())
+	store.SetLatency(100 * time.Millisecond)
+	g, server := newTestGateway(t, &config.Config{}, store, okUpstream)
+
+	const requests = 3
+	for i := 0; i < requests; i++ {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/test/v1/models", nil)
+		do(t, req)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := g.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Flush with a short deadline = %v, want a deadline error while saves are pending", err)
+	}
+
+	if records := storedRecords(t, g); len(records) != requests {
+		t.Errorf("got %d stored records, want all %d once drained", len(records), requests)
+	}
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"openailogger/storage"
+)
+
+// grpcPreviewBytes is how much of a protobuf body is kept as a preview
+const grpcPreviewBytes = 4096
+
+// isGRPC reports whether a content type is gRPC, e.g. application/grpc or
+// application/grpc+proto
+func isGRPC(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/grpc" || strings.HasPrefix(mediaType, "application/grpc+"))
+}
+
+// captureGRPCStatus records the grpc-status and grpc-message of a gRPC
+// response. They arrive as trailers once the body is read, or as headers
+// for trailers-only responses. The caller holds the record lock.
+func captureGRPCStatus(resp *http.Response, record *storage.Record) {
+	value, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if value == "" {
+		value, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return
+	}
+
+	record.GRPCStatus = &code
+	// grpc-message is percent-encoded
+	if decoded, err := url.PathUnescape(message); err == nil {
+		message = decoded
+	}
+	record.GRPCMessage = message
+	if code != 0 && record.ErrorType == "" {
+		record.ErrorType = "grpc_error"
+	}
+}
+
+// previewGRPCBodies replaces the protobuf bodies of a gRPC exchange with
+// base64 previews of their first bytes, so they stay readable as JSON.
+// Masks don't apply to the previews, their patterns can't match base64.
+func previewGRPCBodies(record *storage.Record) {
+	preview := func(body string) string {
+		if len(body) > grpcPreviewBytes {
+			body = body[:grpcPreviewBytes]
+		}
+		return base64.StdEncoding.EncodeToString([]byte(body))
+	}
+
+	if len(record.RequestBody) > grpcPreviewBytes {
+		record.RequestTruncated = true
+	}
+	if len(record.ResponseBody) > grpcPreviewBytes {
+		record.ResponseTruncated = true
+	}
+	record.RequestBody = preview(record.RequestBody)
+	record.ResponseBody = preview(record.ResponseBody)
+	record.ResponseChunks = nil
+	record.BodyEncoding = "base64"
+}
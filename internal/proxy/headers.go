@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// sensitiveHeaders are captured with their values redacted
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Api-Key":             true,
+	"X-Api-Key":           true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// truncatedHeaderKey marks a header capture that hit the size cap
+const truncatedHeaderKey = "X-Capture-Truncated"
+
+// captureHeaders copies headers for storage, redacting credentials and
+// stopping once the configured byte cap is reached
+func (g *Gateway) captureHeaders(header http.Header) map[string][]string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	maxBytes := g.config.MaxHeaderBytes()
+	captured := make(map[string][]string, len(names))
+	var size, omitted int64
+
+	for _, name := range names {
+		for _, value := range header[name] {
+			if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+				value = "[redacted]"
+			}
+
+			n := int64(len(name) + len(value))
+			if size+n > maxBytes {
+				omitted += n
+				continue
+			}
+
+			size += n
+			captured[name] = append(captured[name], value)
+		}
+	}
+
+	if omitted > 0 {
+		captured[truncatedHeaderKey] = []string{fmt.Sprintf("%d header bytes omitted", omitted)}
+	}
+
+	return captured
+}
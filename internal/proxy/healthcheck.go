@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"openailogger/internal/config"
+)
+
+// UpstreamStatus is the latest probe result of one upstream
+type UpstreamStatus struct {
+	URL       string    `json:"url"`
+	Up        bool      `json:"up"`
+	Status    int       `json:"status,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMS int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// healthChecker keeps the probe results of every checked upstream
+type healthChecker struct {
+	mu       sync.RWMutex
+	statuses map[string][]UpstreamStatus // by route name, in target order
+}
+
+// startHealthChecks probes the upstreams of every route with health checks
+// enabled until the gateway is closed
+func (g *Gateway) startHealthChecks() {
+	g.health = &healthChecker{statuses: make(map[string][]UpstreamStatus)}
+	for name, route := range g.config.Routes {
+		if route.HealthCheck.Enabled {
+			go g.healthCheckLoop(name, route)
+		}
+	}
+}
+
+// healthCheckLoop probes a route's upstreams right away and then on every
+// interval
+func (g *Gateway) healthCheckLoop(name string, route config.RouteConfig) {
+	ticker := time.NewTicker(route.HealthCheck.IntervalDuration())
+	defer ticker.Stop()
+	for {
+		targets := route.Targets()
+		statuses := make([]UpstreamStatus, len(targets))
+		for i, target := range targets {
+			statuses[i] = g.probe(target, route.HealthCheck, g.routeTransport(route))
+		}
+
+		g.health.mu.Lock()
+		g.health.statuses[name] = statuses
+		g.health.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// probe checks one upstream: a GET of the configured path, or a HEAD of the
+// upstream URL. Any response below 500 counts as up, e.g. a 401 still
+// proves the upstream is reachable.
+func (g *Gateway) probe(target config.UpstreamConfig, check config.HealthCheckConfig, transport http.RoundTripper) UpstreamStatus {
+	status := UpstreamStatus{URL: target.URL, CheckedAt: time.Now().UTC()}
+
+	method, probeURL := http.MethodHead, target.URL
+	if check.Path != "" {
+		method = http.MethodGet
+		probeURL = strings.TrimSuffix(target.URL, "/") + "/" + strings.TrimPrefix(check.Path, "/")
+	}
+	if _, err := url.Parse(probeURL); err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), check.TimeoutDuration())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, probeURL, nil)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	for name, value := range target.Headers {
+		req.Header.Set(name, value)
+	}
+
+	start := time.Now()
+	resp, err := transport.RoundTrip(req)
+	status.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	resp.Body.Close()
+
+	status.Status = resp.StatusCode
+	status.Up = resp.StatusCode < 500
+	return status
+}
+
+// UpstreamHealth returns the latest probe results of a route's upstreams,
+// nil when the route isn't health checked or hasn't been probed yet
+func (g *Gateway) UpstreamHealth(route string) []UpstreamStatus {
+	g.health.mu.RLock()
+	defer g.health.mu.RUnlock()
+	return append([]UpstreamStatus(nil), g.health.statuses[route]...)
+}
@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"openailogger/storage"
+)
+
+// dataImagePattern matches base64 data URLs of images as embedded by vision
+// requests, e.g. in messages[].content[].image_url.url
+var dataImagePattern = regexp.MustCompile(`data:(image/[A-Za-z0-9.+-]+);base64,([A-Za-z0-9+/]+=*)`)
+
+// strippedImagePattern matches the placeholders stripImages leaves behind
+var strippedImagePattern = regexp.MustCompile(`\[image: \d+ bytes, image/[A-Za-z0-9.+-]+\]`)
+
+// stripImages replaces base64 images in the captured request body with a
+// placeholder naming their size and type, keeping the rest of the JSON
+// intact. The forwarded request is unaffected.
+func (g *Gateway) stripImages(record *storage.Record) {
+	if !g.config.Capture.StripImages || !strings.Contains(record.RequestBody, ";base64,") {
+		return
+	}
+
+	minBytes := g.config.Capture.StripImagesMinKB * 1024
+	record.RequestBody = dataImagePattern.ReplaceAllStringFunc(record.RequestBody, func(match string) string {
+		groups := dataImagePattern.FindStringSubmatch(match)
+		encoded := groups[2]
+		size := len(encoded)*3/4 - (len(encoded) - len(strings.TrimRight(encoded, "=")))
+		if size < minBytes {
+			return match
+		}
+		return fmt.Sprintf("[image: %d bytes, %s]", size, groups[1])
+	})
+}
@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"openailogger/storage"
+)
+
+// inflight lets a record be force-finalized when its exchange is aborted or
+// outlives max_inflight_age, for example a stream the client stopped reading
+// while the connection stays open. Writes to the record while proxying
+// happen under mu, and stop once the record has been taken over.
+type inflight struct {
+	mu         sync.Mutex
+	timer      *time.Timer
+	done       bool
+	forced     bool
+	dropped    bool
+	requestTee *cappedBuffer
+	body       *bytes.Buffer
+	chunks     *[]string
+	// Bytes actually transferred, which captures may cap
+	requestBytes  atomic.Int64
+	responseBytes atomic.Int64
+}
+
+type inflightKey struct{}
+
+// trackInflight returns the request carrying a tracker for the record and
+// arms the forced finalization timer when max_inflight_age is set
+func (g *Gateway) trackInflight(r *http.Request, record *storage.Record) (*http.Request, *inflight) {
+	flight := &inflight{}
+	if age := g.config.Capture.MaxInflightAgeDuration(); age > 0 {
+		flight.timer = time.AfterFunc(age, func() {
+			g.forceFinalize(flight, record, r, fmt.Sprintf("still in flight after %s", age))
+		})
+	}
+	return r.WithContext(context.WithValue(r.Context(), inflightKey{}, flight)), flight
+}
+
+// inflightFrom returns the tracker of the request, nil when untracked
+func inflightFrom(ctx context.Context) *inflight {
+	flight, _ := ctx.Value(inflightKey{}).(*inflight)
+	return flight
+}
+
+// acquire locks the record for writing and reports whether the proxy still
+// owns it. Every acquire must be paired with release.
+func (f *inflight) acquire() bool {
+	if f == nil {
+		return true
+	}
+	f.mu.Lock()
+	return !f.forced
+}
+
+// release unlocks the record after acquire
+func (f *inflight) release() {
+	if f != nil {
+		f.mu.Unlock()
+	}
+}
+
+// receivedBytes returns the request body bytes read so far, 0 when untracked
+func (f *inflight) receivedBytes() int64 {
+	if f == nil {
+		return 0
+	}
+	return f.requestBytes.Load()
+}
+
+// attach registers the response capture buffers so a forced finalization
+// keeps what was received so far. The caller holds the lock.
+func (f *inflight) attach(body *bytes.Buffer, chunks *[]string) {
+	if f != nil {
+		f.body = body
+		f.chunks = chunks
+	}
+}
+
+// drop marks the record as not to be stored. The caller holds the lock.
+func (f *inflight) drop() {
+	if f != nil {
+		f.dropped = true
+	}
+}
+
+// finish hands the record back to the proxy for the normal finalization and
+// reports false when it was already force-finalized or dropped
+func (f *inflight) finish() bool {
+	if f == nil {
+		return true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.forced || f.dropped {
+		if f.timer != nil {
+			f.timer.Stop()
+		}
+		return false
+	}
+	f.done = true
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+	return true
+}
+
+// forceFinalize stores a copy of the record with whatever was captured so
+// far, marked incomplete
+func (g *Gateway) forceFinalize(f *inflight, record *storage.Record, r *http.Request, reason string) {
+	f.mu.Lock()
+	if f.done || f.dropped {
+		f.mu.Unlock()
+		return
+	}
+	f.forced = true
+
+	snapshot := *record
+	if f.requestTee != nil {
+		snapshot.RequestBody, snapshot.RequestTruncated = f.requestTee.contents()
+	}
+	if n := f.requestBytes.Load(); n > 0 {
+		snapshot.SizeReqBytes = n
+	}
+	if f.body != nil {
+		snapshot.ResponseBody = f.body.String()
+		snapshot.SizeResBytes = f.responseBytes.Load()
+		if len(*f.chunks) > 0 {
+			snapshot.ResponseChunks = append([]string(nil), *f.chunks...)
+		}
+	}
+	f.mu.Unlock()
+
+	log.Printf("Record %s %s, finalizing it as incomplete", record.ID, reason)
+	snapshot.Incomplete = true
+	snapshot.DurationMS = time.Since(record.Timestamp).Milliseconds()
+	g.finishRecord(&snapshot, r)
+	g.enqueue(&snapshot)
+}
+
+// guardedWriter writes up to maxSize bytes to buf while holding the record
+// lock, dropping writes once the record was force-finalized
+type guardedWriter struct {
+	flight  *inflight
+	buf     *bytes.Buffer
+	maxSize int64
+}
+
+func (gw *guardedWriter) Write(p []byte) (int, error) {
+	if gw.flight.acquire() {
+		if remaining := gw.maxSize - int64(gw.buf.Len()); remaining > 0 {
+			gw.buf.Write(p[:min(int64(len(p)), remaining)])
+		}
+	}
+	gw.flight.release()
+	return len(p), nil
+}
+
+// countingReader counts the bytes read through it, independent of how much
+// of them is captured
+type countingReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	cr.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"openailogger/storage"
+)
+
+const (
+	// ttlHeader lets a client set how long its record is kept, e.g. "1h"
+	ttlHeader = "X-Capture-TTL"
+	// janitorInterval is how often records past their ExpiresAt and expired
+	// affinity sessions are deleted
+	janitorInterval = time.Minute
+)
+
+// applyTTL sets the record's expiry from the TTL request header and removes
+// the header so it isn't forwarded
+func (g *Gateway) applyTTL(r *http.Request, record *storage.Record) {
+	value := r.Header.Get(ttlHeader)
+	if value == "" {
+		return
+	}
+	r.Header.Del(ttlHeader)
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Printf("Ignoring invalid %s %q for record %s", ttlHeader, value, record.ID)
+		return
+	}
+	expires := record.Timestamp.Add(ttl)
+	record.ExpiresAt = &expires
+}
+
+// janitor deletes expired records and affinity sessions until stop is
+// closed
+func (g *Gateway) janitor(stop <-chan struct{}) {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.deleteExpired()
+			for _, picker := range g.balancers {
+				if picker.sessions != nil {
+					picker.sweep()
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// deleteExpired removes the records whose ExpiresAt has passed. Pinned
+// records are kept.
+func (g *Gateway) deleteExpired() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	unpinned := false
+	records, _, err := g.store.ListSummary(ctx, storage.Query{ExpiresBefore: &now, Pinned: &unpinned})
+	if err != nil {
+		log.Printf("Failed to list expired records: %v", err)
+		return
+	}
+
+	for _, record := range records {
+		if err := g.store.Delete(ctx, record.ID); err != nil {
+			log.Printf("Failed to delete expired record %s: %v", record.ID, err)
+		}
+	}
+	if len(records) > 0 {
+		log.Printf("Deleted %d expired records", len(records))
+	}
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"log"
+	"regexp"
+
+	"openailogger/internal/config"
+	"openailogger/storage"
+)
+
+// builtinMasks are the patterns masks can enable by name alone
+var builtinMasks = map[string]config.MaskConfig{
+	"email": {
+		Pattern:     `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+		Replacement: "[EMAIL]",
+	},
+	"credit_card": {
+		Pattern:     `\b(?:\d[ -]?){12,18}\d\b`,
+		Replacement: "[CREDIT_CARD]",
+	},
+	"phone": {
+		Pattern:     `\+?\b\d{1,3}[ .-]?\(?\d{3}\)?[ .-]?\d{3}[ .-]?\d{4}\b`,
+		Replacement: "[PHONE]",
+	},
+	"ssn": {
+		Pattern:     `\b\d{3}-\d{2}-\d{4}\b`,
+		Replacement: "[SSN]",
+	},
+}
+
+// bodyMask is a compiled masking rule
+type bodyMask struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// compileMasks resolves built-in names and compiles the configured masks,
+// skipping invalid ones
+func compileMasks(masks []config.MaskConfig) []bodyMask {
+	var compiled []bodyMask
+	for i, mask := range masks {
+		name := mask.RuleName(i)
+		if mask.Pattern == "" {
+			builtin, ok := builtinMasks[mask.Name]
+			if !ok {
+				log.Printf("Unknown built-in mask %q, skipping", name)
+				continue
+			}
+			if mask.Replacement == "" {
+				mask.Replacement = builtin.Replacement
+			}
+			mask.Pattern = builtin.Pattern
+		}
+		if mask.Replacement == "" {
+			mask.Replacement = "[MASKED]"
+		}
+
+		pattern, err := regexp.Compile(mask.Pattern)
+		if err != nil {
+			log.Printf("Invalid pattern for mask %q, skipping: %v", name, err)
+			continue
+		}
+		compiled = append(compiled, bodyMask{name: name, pattern: pattern, replacement: mask.Replacement})
+	}
+	return compiled
+}
+
+// applyMasks replaces sensitive content in the captured bodies and the title
+// taken from them. The proxied traffic is untouched.
+func (g *Gateway) applyMasks(record *storage.Record) {
+	if len(g.masks) == 0 || record.BodyEncoding != "" {
+		return // base64 previews can't be matched
+	}
+
+	// Substitutions are counted per mask so redaction can be audited
+	// without storing what was masked
+	counts := make(map[string]int)
+	mask := func(s string) string {
+		for _, m := range g.masks {
+			if n := len(m.pattern.FindAllStringIndex(s, -1)); n > 0 {
+				counts[m.name] += n
+				s = m.pattern.ReplaceAllString(s, m.replacement)
+			}
+		}
+		return s
+	}
+
+	record.Title = mask(record.Title)
+	record.RequestBody = mask(record.RequestBody)
+	record.ResponseBody = mask(record.ResponseBody)
+	record.RewrittenResponse = mask(record.RewrittenResponse)
+	record.ReconstructedResponse = mask(record.ReconstructedResponse)
+	for _, values := range record.RequestForm {
+		for i := range values {
+			values[i] = mask(values[i])
+		}
+	}
+	for i := range record.ResponseChunks {
+		record.ResponseChunks[i] = mask(record.ResponseChunks[i])
+	}
+	for i := range record.WSMessages {
+		if record.WSMessages[i].Type == "text" {
+			record.WSMessages[i].Data = mask(record.WSMessages[i].Data)
+		}
+	}
+
+	if len(counts) > 0 {
+		record.Redactions = counts
+	}
+}
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"openailogger/storage"
+)
+
+// metaHeader lets a client attach metadata to its record, e.g.
+// "team=nlp;env=prod"
+const metaHeader = "X-Capture-Meta"
+
+// takeMetadata returns the values of the metadata request header and removes
+// it so it isn't forwarded, whether or not the request is captured
+func takeMetadata(r *http.Request) []string {
+	values := r.Header.Values(metaHeader)
+	r.Header.Del(metaHeader)
+	return values
+}
+
+// applyMetadata parses the metadata header values into the record. Entries
+// without "=" are ignored.
+func (g *Gateway) applyMetadata(values []string, record *storage.Record) {
+	for _, value := range values {
+		for _, entry := range strings.Split(value, ";") {
+			key, val, ok := strings.Cut(entry, "=")
+			key = strings.TrimSpace(key)
+			if !ok || key == "" {
+				continue
+			}
+			if record.Metadata == nil {
+				record.Metadata = make(map[string]string)
+			}
+			record.Metadata[key] = strings.TrimSpace(val)
+		}
+	}
+}
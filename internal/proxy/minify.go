@@ -0,0 +1,23 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"openailogger/storage"
+)
+
+// minifyRequestBody removes insignificant whitespace from JSON request
+// bodies before storage. Other bodies are kept as captured, and
+// SizeReqBytes still counts the bytes sent.
+func (g *Gateway) minifyRequestBody(record *storage.Record) {
+	if !g.config.Capture.MinifyRequestBodies || record.RequestBody == "" || record.BodyEncoding != "" {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(record.RequestBody)); err != nil {
+		return // Not JSON, or truncated
+	}
+	record.RequestBody = buf.String()
+}
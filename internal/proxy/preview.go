@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"openailogger/storage"
+)
+
+// previewChars is the length of the body previews shown in list views
+const previewChars = 200
+
+// setPreviews stores short previews of the bodies for list views: the last
+// user message of chat requests and the generated text of chat replies,
+// otherwise the start of the raw body. Runs after the retention policies so
+// previews never keep what they dropped.
+func (g *Gateway) setPreviews(record *storage.Record) {
+	if record.BodyEncoding != "" {
+		return // Binary bodies have no readable preview
+	}
+
+	record.RequestPreview = ""
+	if record.RequestBody != "" {
+		text, ok := lastUserMessage(record.RequestBody)
+		if !ok {
+			text = record.RequestBody
+		}
+		record.RequestPreview = preview(text)
+	}
+
+	record.ResponsePreview = ""
+	switch {
+	case record.ReconstructedResponse != "":
+		record.ResponsePreview = preview(record.ReconstructedResponse)
+	case record.ResponseBody != "":
+		text, ok := replyText(record.ResponseBody)
+		if !ok {
+			text = record.ResponseBody
+		}
+		record.ResponsePreview = preview(text)
+	}
+}
+
+// lastUserMessage returns the text of the last user message of a chat
+// request, joining the text parts of multi-part content
+func lastUserMessage(body string) (string, bool) {
+	var request struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if json.Unmarshal([]byte(body), &request) != nil {
+		return "", false
+	}
+
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if message := request.Messages[i]; message.Role == "user" {
+			return contentText(message.Content), true
+		}
+	}
+	return "", false
+}
+
+// replyText returns the message content of the first choice of a chat or
+// completion response
+func replyText(body string) (string, bool) {
+	var response struct {
+		Choices []struct {
+			Text    string `json:"text"`
+			Message struct {
+				Content json.RawMessage `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal([]byte(body), &response) != nil || len(response.Choices) == 0 {
+		return "", false
+	}
+
+	choice := response.Choices[0]
+	if choice.Text != "" {
+		return choice.Text, true
+	}
+	return contentText(choice.Message.Content), true
+}
+
+// contentText returns message content given as a string or as a list of
+// parts, of which the text parts are joined
+func contentText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &parts) != nil {
+		return ""
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+// preview cuts s to previewChars characters on one line
+func preview(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= previewChars {
+		return s
+	}
+	return string([]rune(s)[:previewChars]) + "..."
+}
@@ -3,82 +3,497 @@ package proxy
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptrace"
 	"net/http/httputil"
 	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 
 	"openailogger/internal/config"
+	"openailogger/internal/sink"
 	"openailogger/storage"
 )
 
 // Gateway represents the capture gateway
 type Gateway struct {
-	config  *config.Config
-	store   storage.Store
-	workers chan *storage.Record
+	config    *config.Config
+	store     storage.Store
+	workers   chan *storage.Record
+	transport http.RoundTripper
+	grpc      http.RoundTripper // transport of gRPC routes
+	auth      Authenticator
+	cache     *responseCache
+	balancers map[string]*weightedPicker // by route name
+	sinks     []sink.Sink
+	masks     []bodyMask
+	pending   atomic.Int64 // records enqueued but not yet saved
+	workerWG  sync.WaitGroup
+	spill     *spillQueue // nil unless overflow_spill_path is set
+	spillStop chan struct{}
+	spillDone chan struct{}
+	stop      chan struct{} // stops background tasks such as the janitor
+	health    *healthChecker
+	dead      *deadLetters
 }
 
 // New creates a new capture gateway
 func New(cfg *config.Config, store storage.Store) *Gateway {
 	g := &Gateway{
-		config:  cfg,
-		store:   store,
-		workers: make(chan *storage.Record, cfg.Capture.WorkerPoolSize*2),
+		config:    cfg,
+		store:     store,
+		workers:   make(chan *storage.Record, max(cfg.Capture.WorkerPoolSize*2, 0)),
+		transport: newUpstreamTransport(cfg.Transport),
+		grpc:      newGRPCTransport(cfg.Transport),
+		cache:     newResponseCache(),
+		stop:      make(chan struct{}),
+		masks:     compileMasks(cfg.Capture.Masks),
+		dead:      &deadLetters{max: cfg.Capture.DeadLetterLimit()},
+	}
+
+	g.balancers = make(map[string]*weightedPicker)
+	for name, route := range cfg.Routes {
+		if len(route.Upstreams) > 0 {
+			g.balancers[name] = newWeightedPicker(route.Targets())
+			if route.Affinity.Enabled {
+				g.balancers[name].sessions = make(map[string]*stickySession)
+				g.balancers[name].maxSessions = route.Affinity.SessionLimit()
+			}
+		}
+	}
+
+	if cfg.Webhook.URL != "" {
+		g.sinks = append(g.sinks, sink.NewWebhook(cfg.Webhook))
+	}
+	if cfg.Sink.Type != "" {
+		if s, err := sink.New(cfg.Sink); err != nil {
+			log.Printf("Failed to start sink: %v", err)
+		} else {
+			g.sinks = append(g.sinks, s)
+		}
+	}
+
+	if len(cfg.Auth.Tokens) > 0 {
+		g.auth = newTokenAuthenticator(cfg.Auth)
 	}
 
 	// Start worker pool for async storage
+	if cfg.Capture.WorkerPoolSize <= 0 {
+		log.Printf("No storage workers configured, records are saved inline and delay responses; set capture.worker_pool_size to store them asynchronously")
+	}
 	for i := 0; i < cfg.Capture.WorkerPoolSize; i++ {
+		g.workerWG.Add(1)
 		go g.storageWorker()
 	}
 
+	go g.janitor(g.stop)
+	g.startHealthChecks()
+
+	// Records overflowing the worker queue go to disk instead of being dropped
+	if path := cfg.Capture.OverflowSpillPath; path != "" {
+		spill, leftover, err := openSpillQueue(path)
+		if err != nil {
+			log.Printf("Failed to open overflow spill file, overflowing records will be dropped: %v", err)
+		} else {
+			if leftover > 0 {
+				log.Printf("Recovering %d spilled records from %s", leftover, path)
+			}
+			g.spill = spill
+			g.pending.Add(int64(leftover))
+			g.spillStop = make(chan struct{})
+			g.spillDone = make(chan struct{})
+			go g.drainSpill(g.spillStop)
+		}
+	}
+
 	return g
 }
 
+// SetAuthenticator installs a custom authentication hook, replacing any
+// token authentication from the config
+func (g *Gateway) SetAuthenticator(auth Authenticator) {
+	g.auth = auth
+}
+
 // ServeHTTP implements the main proxy handler
 func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if record := g.serve(w, r); record != nil && g.keepRecord(record) {
+		g.enqueue(record)
+	}
+}
+
+// serve proxies a request and returns the captured record, or nil when the
+// request was rejected or not captured
+func (g *Gateway) serve(w http.ResponseWriter, r *http.Request) *storage.Record {
 	// Find matching route
 	mount := g.extractMount(r.URL.Path)
 	providerName, route, found := g.config.GetRouteByMount(mount)
 
 	if !found {
 		http.NotFound(w, r)
-		return
+		return nil
+	}
+
+	// Authenticate before anything is forwarded
+	var tenantID string
+	if g.auth != nil {
+		var err error
+		tenantID, err = g.auth.Authenticate(r, providerName)
+		if err != nil {
+			status := http.StatusUnauthorized
+			var authErr *AuthError
+			if errors.As(err, &authErr) {
+				status = authErr.Status
+			}
+			http.Error(w, err.Error(), status)
+			return nil
+		}
+	}
+
+	// Methods the route doesn't expect never reach the upstream
+	if !route.AllowsMethod(r.Method) {
+		return g.rejectMethod(w, r, providerName, tenantID, route)
 	}
 
-	// Parse upstream URL
-	upstream, err := url.Parse(route.Upstream)
+	// Pick and parse upstream URL
+	target := g.pickUpstream(providerName, route, r)
+	upstream, err := url.Parse(target.URL)
 	if err != nil {
 		http.Error(w, "Invalid upstream URL", http.StatusInternalServerError)
-		return
+		return nil
+	}
+	for name, value := range target.Headers {
+		r.Header.Set(name, value)
+	}
+	metadata := takeMetadata(r)
+
+	// Noise such as preflights and load balancer probes is proxied uncaptured
+	if g.skipCapture(r, route) {
+		g.newReverseProxy(upstream, route, nil).ServeHTTP(w, r)
+		return nil
 	}
 
 	// Create record for capture
 	record := &storage.Record{
-		ID:        uuid.New().String(),
-		Timestamp: time.Now(),
+		ID:        newRecordID(route),
+		Timestamp: time.Now().UTC().Truncate(g.config.Capture.TimestampResolution()),
 		Provider:  providerName,
+		TenantID:  tenantID,
 		Method:    r.Method,
 		URL:       r.URL.String(),
-		Upstream:  route.Upstream,
+		Upstream:  target.URL,
+	}
+	// Weighted upstreams may share a URL, their names tell them apart
+	record.UpstreamName = target.Name
+	if route.IsGRPC() {
+		record.GRPCMethod = strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(route.Mount, "/"))
+	}
+
+	if g.config.Capture.CaptureWireLines {
+		record.RequestLine = fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto)
+	}
+
+	g.applyTTL(r, record)
+	g.applyMetadata(metadata, record)
+
+	// Records whose exchange is aborted or never completes are finalized
+	// with what was captured instead of being lost
+	r, flight := g.trackInflight(r, record)
+	defer func() {
+		if p := recover(); p != nil {
+			// ReverseProxy aborts the handler when the client goes away
+			// mid-response
+			if p == http.ErrAbortHandler {
+				g.forceFinalize(flight, record, r, "aborted by the client")
+			}
+			panic(p)
+		}
+	}()
+
+	// Sizes count every byte transferred, not just the captured ones
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &countingReader{ReadCloser: r.Body, n: &flight.requestBytes}
 	}
 
-	// Capture request body
-	if err := g.captureRequestBody(r, record); err != nil {
+	// Capture request body, either up front or while it is being forwarded.
+	// gRPC streams may not end before the response starts, so they are
+	// always captured while forwarded and passed through when oversized,
+	// while model rewrites and the other oversize modes need the whole
+	// body up front.
+	var requestTee *cappedBuffer
+	teeing := g.config.Capture.RequestCaptureMode == "tee" && len(route.ModelRewrite) == 0 &&
+		g.config.Capture.OversizeMode() == "passthrough"
+	if teeing || route.IsGRPC() {
+		requestTee = g.teeRequestBody(r)
+		flight.requestTee = requestTee
+	} else if err := g.captureRequestBody(r, record); errors.Is(err, errOversize) {
+		if !flight.finish() {
+			return nil
+		}
+		g.rejectOversize(w, r, record)
+		return record
+	} else if err != nil {
 		log.Printf("Failed to capture request body: %v", err)
 		http.Error(w, "Failed to process request", http.StatusInternalServerError)
+		return nil
+	}
+
+	// The body sent upstream, which retries replay
+	forwardBody := record.RequestBody
+	if rewritten, ok := g.rewriteModel(r, route, record); ok {
+		forwardBody = rewritten
+	}
+
+	start := time.Now()
+
+	// Identical requests on caching routes are answered from the cache
+	var fill *cacheFill
+	if route.Cache.Enabled && requestTee == nil && !record.RequestTruncated {
+		cached, f := g.cache.lookup(r.Context(), requestCacheKey(record, r.Header, route.CacheKeyIgnoreFields))
+		if cached != nil {
+			if !flight.finish() {
+				return nil
+			}
+			// Cached responses never reach the upstream, so their upstream
+			// latency stays zero and all their time is the gateway's
+			writeCached(w, record, cached)
+			record.DurationMS = time.Since(start).Milliseconds()
+			record.GatewayOverheadMS = record.DurationMS
+			g.finishRecord(record, r)
+			return record
+		}
+		if fill = f; fill != nil {
+			w = fill.wrap(w, g.config.MaxResponseBodyBytes())
+			defer fill.abandon()
+		}
+	}
+
+	proxy := g.newReverseProxy(upstream, route, record)
+	if transport := g.newRetryTransport(route, record, forwardBody, requestTee != nil); transport != nil {
+		proxy.Transport = transport
+	}
+
+	timer := &upstreamTimer{}
+	proxy.Transport = timer.wrap(proxy.Transport)
+	r = r.WithContext(httptrace.WithClientTrace(r.Context(), timer.trace()))
+
+	proxy.ServeHTTP(w, r)
+	if !flight.finish() {
+		return nil
+	}
+	record.DurationMS = time.Since(start).Milliseconds()
+	record.UpstreamLatencyMS = timer.latency().Milliseconds()
+	// Time the gateway added on top of the upstream exchange, e.g. capture
+	// and request buffering
+	record.GatewayOverheadMS = max(record.DurationMS-timer.exchange().Milliseconds(), 0)
+
+	if fill != nil {
+		fill.finish(record, route.Cache.TTLDuration())
+	}
+
+	if requestTee != nil {
+		record.RequestBody, record.RequestTruncated = requestTee.contents()
+	}
+
+	g.finishRecord(record, r)
+	return record
+}
+
+// rejectMethod answers a request with a method the route doesn't allow with
+// 405 and records the rejection, unless it is noise that isn't captured
+func (g *Gateway) rejectMethod(w http.ResponseWriter, r *http.Request, providerName, tenantID string, route config.RouteConfig) *storage.Record {
+	w.Header().Set("Allow", strings.Join(route.AllowedMethods, ", "))
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if g.skipCapture(r, route) {
+		return nil
+	}
+
+	message := fmt.Sprintf("method %s is not allowed on route %s", r.Method, providerName)
+	record := &storage.Record{
+		ID:        newRecordID(route),
+		Timestamp: time.Now().UTC().Truncate(g.config.Capture.TimestampResolution()),
+		Provider:  providerName,
+		TenantID:  tenantID,
+		Method:    r.Method,
+		URL:       r.URL.String(),
+		Status:    http.StatusMethodNotAllowed,
+		Error:     &message,
+		ErrorType: "method_not_allowed",
+	}
+	g.finishRecord(record, r)
+	return record
+}
+
+// errOversize reports a request body over the capture cap in reject mode
+var errOversize = errors.New("request body exceeds the capture cap")
+
+// rejectOversize answers a request whose body exceeds the capture cap with
+// 413 and records the rejection with the captured part of the body
+func (g *Gateway) rejectOversize(w http.ResponseWriter, r *http.Request, record *storage.Record) {
+	http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+
+	message := fmt.Sprintf("request body exceeds %d bytes", g.config.MaxRequestBodyBytes())
+	record.Status = http.StatusRequestEntityTooLarge
+	record.Error = &message
+	record.ErrorType = "request_too_large"
+	g.finishRecord(record, r)
+}
+
+// newRecordID returns a fresh record ID carrying the route's prefix
+func newRecordID(route config.RouteConfig) string {
+	id := uuid.New().String()
+	if route.IDPrefix == "" {
+		return id
+	}
+	return route.IDPrefix + "-" + id
+}
+
+// finishRecord derives metadata from the captured bodies and then applies
+// the body retention policies
+func (g *Gateway) finishRecord(record *storage.Record, r *http.Request) {
+	if record.ErrorType == "" {
+		record.ErrorType = classifyStatus(record.Status)
+	}
+	record.CanonicalProvider = g.config.CanonicalProvider(record.Provider)
+
+	// Every path counts the bytes received, bodies rejected unread by their
+	// declared length
+	if n := inflightFrom(r.Context()).receivedBytes(); n > 0 {
+		record.SizeReqBytes = n
+	} else if record.SizeReqBytes == 0 && r.ContentLength > 0 {
+		record.SizeReqBytes = r.ContentLength
+	}
+
+	record.RequestCharset = contentCharset(r.Header.Get("Content-Type"))
+	g.measureDecompressed(record)
+	if isGRPC(r.Header.Get("Content-Type")) {
+		previewGRPCBodies(record)
+	}
+	g.transcodeBodies(record)
+	g.extractDerived(record, r.Header.Get("Content-Type"))
+
+	g.stripImages(record)
+	g.minifyRequestBody(record)
+	g.applyMasks(record)
+	g.applyBodyPolicy(record)
+	g.applyRetention(record)
+	g.setPreviews(record)
+	g.sampleBodies(record)
+}
+
+// extractDerived extracts model hint and form fields from the request body,
+// token usage and choices from the response, and the other derived fields
+func (g *Gateway) extractDerived(record *storage.Record, contentType string) {
+	g.extractModelHint(record)
+	g.extractTitle(record)
+	g.extractKind(record)
+	g.extractBatch(record, contentType)
+	g.extractForm(record, contentType)
+	g.extractUsage(record)
+	g.extractChoices(record)
+	g.extractContentFilter(record)
+	g.extractReconstruction(record)
+	g.extractEventTypes(record)
+	record.RequestHash = storage.RequestHash(record)
+}
+
+// reprocessedFields are the derived fields Reprocess fills in when unset
+var reprocessedFields = []string{
+	"ModelHint", "Title", "Kind", "BatchID", "BatchFileID", "BatchLines",
+	"RequestForm", "Usage", "ChoiceCount", "FinishReasons", "ToolCallCount",
+	"ContentChars", "ContentFiltered", "FilterCategories",
+	"ReconstructedResponse", "ReconstructionPartial", "EventTypeCounts",
+	"RequestPreview", "ResponsePreview",
+}
+
+// Reprocess fills in the derived fields a stored record lacks from its
+// stored bodies, e.g. to backfill fields added by an upgrade. Fields already
+// set are kept, since the stored bodies may have been masked, dropped or
+// sampled since they were derived, and the request hash is never
+// recomputed.
+func (g *Gateway) Reprocess(record *storage.Record) {
+	if record.ErrorType == "" {
+		record.ErrorType = classifyStatus(record.Status)
+	}
+	if record.CanonicalProvider == "" {
+		record.CanonicalProvider = g.config.CanonicalProvider(record.Provider)
+	}
+
+	derived := *record
+	switch {
+	case record.BodyEncoding != "":
+		// Previews of binary bodies have nothing to extract
+		g.extractKind(&derived)
+	case isSampled(record.RequestBody) || isSampled(record.ResponseBody):
+		// Sampled bodies would yield partial counts
+		g.extractKind(&derived)
+	default:
+		var contentType string
+		if values := record.RequestHeaders["Content-Type"]; len(values) > 0 {
+			contentType = values[0]
+		}
+		g.extractDerived(&derived, contentType)
+		g.setPreviews(&derived)
+	}
+
+	target := reflect.ValueOf(record).Elem()
+	source := reflect.ValueOf(&derived).Elem()
+	for _, name := range reprocessedFields {
+		if field := target.FieldByName(name); field.IsZero() {
+			field.Set(source.FieldByName(name))
+		}
+	}
+}
+
+// enqueue hands a record to the storage workers, or saves it inline when
+// no workers are configured
+func (g *Gateway) enqueue(record *storage.Record) {
+	record.EnqueuedAt = time.Now()
+	g.pending.Add(1)
+	if g.config.Capture.WorkerPoolSize <= 0 {
+		g.saveRecord(record)
 		return
 	}
 
-	// Create reverse proxy
-	proxy := &httputil.ReverseProxy{
+	select {
+	case g.workers <- record:
+	default:
+		if g.spill != nil {
+			err := g.spill.push(record)
+			if err == nil {
+				return
+			}
+			log.Printf("Failed to spill record %s: %v", record.ID, err)
+		}
+		g.pending.Add(-1)
+		log.Printf("Storage worker queue full, dropping record %s", record.ID)
+	}
+}
+
+// routeTransport returns the transport reaching the route's upstreams, the
+// HTTP/2 one for gRPC routes
+func (g *Gateway) routeTransport(route config.RouteConfig) http.RoundTripper {
+	if route.IsGRPC() {
+		return g.grpc
+	}
+	return g.transport
+}
+
+// newReverseProxy creates a reverse proxy for the route. When record is nil
+// the response is forwarded without being captured.
+func (g *Gateway) newReverseProxy(upstream *url.URL, route config.RouteConfig, record *storage.Record) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Transport: g.routeTransport(route),
 		Director: func(req *http.Request) {
 			req.URL.Scheme = upstream.Scheme
 			req.URL.Host = upstream.Host
@@ -86,50 +501,199 @@ func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			if req.URL.Path == "" {
 				req.URL.Path = "/"
 			}
+			for _, name := range route.StripRequestHeaders {
+				req.Header.Del(name)
+			}
+			if route.WebSocket && isWebSocketUpgrade(req.Header) {
+				// Without permessage-deflate the captured frames stay readable
+				req.Header.Del("Sec-WebSocket-Extensions")
+			}
+			if record != nil && g.config.Capture.CaptureHeaders {
+				flight := inflightFrom(req.Context())
+				if flight.acquire() {
+					record.RequestHeaders = g.captureHeaders(req.Header)
+				}
+				flight.release()
+			}
 		},
 		ModifyResponse: func(resp *http.Response) error {
+			for _, name := range route.StripResponseHeaders {
+				resp.Header.Del(name)
+			}
+			flight := inflightFrom(resp.Request.Context())
+			if !flight.acquire() {
+				record = nil // Already finalized, forward without capture
+			}
+			defer flight.release()
+
+			if g.upstreamOptsOut(resp) && record != nil {
+				flight.drop()
+				record = nil
+			}
+
+			if route.WebSocket && resp.StatusCode == http.StatusSwitchingProtocols {
+				if record != nil {
+					record.Status = resp.StatusCode
+					if g.config.Capture.CaptureHeaders {
+						record.ResponseHeaders = g.captureHeaders(resp.Header)
+					}
+					g.captureWebSocket(resp, record)
+				}
+				return nil
+			}
+
+			rewritten, err := g.rewriteResponse(resp, route, record)
+			if err != nil || record == nil {
+				return err
+			}
 			record.Status = resp.StatusCode
+			if g.config.Capture.CaptureWireLines {
+				record.StatusLine = resp.Proto + " " + resp.Status
+			}
+			record.ResponseCharset = contentCharset(resp.Header.Get("Content-Type"))
+			record.ResponseEncoding = resp.Header.Get("Content-Encoding")
+			if g.config.Capture.CaptureHeaders {
+				record.ResponseHeaders = g.captureHeaders(resp.Header)
+			}
+			if rewritten {
+				return nil
+			}
 			return g.captureResponseBody(resp, record)
 		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			errorType := classifyError(err)
+			status := http.StatusBadGateway
+			if errorType == "upstream_timeout" {
+				status = http.StatusGatewayTimeout
+			}
+			log.Printf("Proxy error for %s %s: %v", req.Method, req.URL, err)
+
+			// record is nil once the exchange is no longer captured
+			if record != nil {
+				flight := inflightFrom(req.Context())
+				if flight.acquire() {
+					message := err.Error()
+					record.Error = &message
+					record.ErrorType = errorType
+					record.Status = status
+				}
+				flight.release()
+			}
+
+			w.WriteHeader(status)
+		},
 	}
+}
 
-	start := time.Now()
-	proxy.ServeHTTP(w, r)
-	record.DurationMS = time.Since(start).Milliseconds()
+// upstreamOptsOut reports whether the response carries the configured
+// no-log header, which is stripped before the client sees it
+func (g *Gateway) upstreamOptsOut(resp *http.Response) bool {
+	name := g.config.Capture.NoLogHeader
+	if name == "" {
+		return false
+	}
 
-	// Extract model hint from request body
-	g.extractModelHint(record)
+	value := resp.Header.Get(name)
+	resp.Header.Del(name)
+	if value == "" {
+		return false
+	}
+	optOut, err := strconv.ParseBool(value)
+	return err != nil || optOut
+}
 
-	// Send to storage worker
-	select {
-	case g.workers <- record:
-	default:
-		log.Printf("Storage worker queue full, dropping record %s", record.ID)
+// skipCapture reports whether a request should be proxied without capture.
+// OPTIONS/HEAD requests and health-check paths are skipped unless the
+// default skipping is disabled.
+func (g *Gateway) skipCapture(r *http.Request, route config.RouteConfig) bool {
+	if g.config.Capture.DisableDefaultSkip {
+		return false
+	}
+
+	if r.Method == http.MethodOptions || r.Method == http.MethodHead {
+		return true
 	}
+
+	relative := strings.TrimPrefix(r.URL.Path, route.Mount)
+	for _, path := range g.config.HealthCheckPaths() {
+		if r.URL.Path == path || relative == path {
+			return true
+		}
+	}
+
+	return false
 }
 
-// captureRequestBody captures and buffers the request body
+// captureRequestBody captures and buffers the request body. Any method may
+// carry one, e.g. PATCH/PUT or DELETE on management APIs, so it only looks
+// at whether a body is present.
 func (g *Gateway) captureRequestBody(r *http.Request, record *storage.Record) error {
-	if r.Body == nil {
+	if r.Body == nil || r.Body == http.NoBody {
 		return nil
 	}
 
-	// Read body with size limit
-	maxBytes := g.config.MaxBodyBytes()
-	body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes))
+	// Bodies declared too large are rejected without reading them
+	maxBytes := g.config.MaxRequestBodyBytes()
+	mode := g.config.Capture.OversizeMode()
+	if mode == "reject" && r.ContentLength > maxBytes {
+		record.RequestTruncated = true
+		return errOversize
+	}
+
+	// Read body with size limit, one extra byte tells us the cap was hit
+	read, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
 	if err != nil {
 		return fmt.Errorf("failed to read request body: %w", err)
 	}
 
+	body := read
+	if int64(len(read)) > maxBytes {
+		body = read[:maxBytes]
+		record.RequestTruncated = true
+		log.Printf("Request body for %s exceeds %d bytes (declared Content-Length %d), capture is incomplete",
+			record.ID, maxBytes, r.ContentLength)
+	}
+
 	record.RequestBody = string(body)
-	record.SizeReqBytes = int64(len(body))
 
-	// Replace body with a new reader for the proxy
-	r.Body = io.NopCloser(bytes.NewReader(body))
+	switch {
+	case !record.RequestTruncated:
+	case mode == "reject":
+		return errOversize
+	case mode == "truncate":
+		// Forward only what was captured, which upstreams likely reject
+		r.Body = &teeBody{reader: bytes.NewReader(body), closer: r.Body}
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		return nil
+	}
+
+	// Replace body for the proxy: the bytes already read followed by whatever
+	// is left unread, so the upstream always gets the complete request
+	r.Body = &teeBody{
+		reader: io.MultiReader(bytes.NewReader(read), r.Body),
+		closer: r.Body,
+	}
 
 	return nil
 }
 
+// teeRequestBody copies the request body into a capped capture buffer as the
+// proxy forwards it, so forwarding starts without waiting for the full body
+func (g *Gateway) teeRequestBody(r *http.Request) *cappedBuffer {
+	capture := &cappedBuffer{maxSize: g.config.MaxRequestBodyBytes()}
+	if r.Body == nil || r.Body == http.NoBody {
+		return capture
+	}
+
+	r.Body = &teeBody{
+		reader: io.TeeReader(r.Body, capture),
+		closer: r.Body,
+	}
+
+	return capture
+}
+
 // captureResponseBody captures the response body while allowing streaming
 func (g *Gateway) captureResponseBody(resp *http.Response, record *storage.Record) error {
 	if resp.Body == nil {
@@ -147,26 +711,48 @@ func (g *Gateway) captureResponseBody(resp *http.Response, record *storage.Recor
 	var buf bytes.Buffer
 	var chunks []string
 
+	// The caller holds the record lock
+	flight := inflightFrom(resp.Request.Context())
+	flight.attach(&buf, &chunks)
+
 	if isStream {
 		// For streaming responses, capture chunks
 		resp.Body = &streamCapture{
 			reader:  resp.Body,
 			buffer:  &buf,
 			chunks:  &chunks,
-			maxSize: g.config.MaxBodyBytes(),
+			maxSize: g.config.MaxResponseBodyBytes(),
+			flight:  flight,
 		}
 	} else {
 		// For non-streaming responses, use a simple tee reader
-		resp.Body = io.NopCloser(io.TeeReader(resp.Body, &buf))
+		resp.Body = io.NopCloser(io.TeeReader(resp.Body, &guardedWriter{
+			flight:  flight,
+			buf:     &buf,
+			maxSize: g.config.MaxResponseBodyBytes(),
+		}))
 	}
 
 	// Set up a callback to capture the final data
 	originalBody := resp.Body
 	resp.Body = &bodyCapture{
-		reader: originalBody,
-		onClose: func() {
+		reader: &countingReader{ReadCloser: originalBody, n: &flight.responseBytes},
+		onClose: func(readErr error) {
+			if !flight.acquire() {
+				flight.release()
+				return
+			}
+			defer flight.release()
+			if readErr != nil {
+				message := fmt.Sprintf("failed to read response body: %v", readErr)
+				record.Error = &message
+				record.ErrorType = "body_read"
+			}
 			record.ResponseBody = buf.String()
-			record.SizeResBytes = int64(buf.Len())
+			record.SizeResBytes = flight.responseBytes.Load()
+			if isGRPC(resp.Header.Get("Content-Type")) {
+				captureGRPCStatus(resp, record)
+			}
 			if len(chunks) > 0 {
 				record.ResponseChunks = chunks
 			}
@@ -185,50 +771,145 @@ func (g *Gateway) extractMount(path string) string {
 	return "/"
 }
 
-// extractModelHint attempts to extract model information from request body
-func (g *Gateway) extractModelHint(record *storage.Record) {
-	if record.RequestBody == "" {
+// applyBodyPolicy drops captured bodies the config says not to keep. It runs
+// once the response status is known and after extraction, so metadata
+// derived from the bodies survives.
+func (g *Gateway) applyBodyPolicy(record *storage.Record) {
+	switch g.config.Capture.CaptureBodiesFor {
+	case "none":
+	case "errors_only":
+		if record.Error != nil || record.Status >= 400 {
+			return
+		}
+	default:
 		return
 	}
 
-	var data map[string]interface{}
-	if err := json.Unmarshal([]byte(record.RequestBody), &data); err != nil {
+	record.RequestBody = ""
+	record.RequestForm = nil
+	record.ResponseBody = ""
+	record.RewrittenResponse = ""
+	record.ResponseChunks = nil
+	record.WSMessages = nil
+	record.ReconstructedResponse = ""
+}
+
+// applyRetention clears the side of the exchange the retain setting excludes,
+// for audits that may keep what was asked but not what the model said
+func (g *Gateway) applyRetention(record *storage.Record) {
+	retain := g.config.Capture.Retain
+	if retain == "" || retain == "both" {
 		return
 	}
 
-	if model, ok := data["model"].(string); ok {
-		record.ModelHint = model
+	if retain == "response" || retain == "neither" {
+		record.RequestBody = ""
+		record.RequestForm = nil
+		record.WSMessages = dropDirection(record.WSMessages, "client")
+	}
+	if retain == "request" || retain == "neither" {
+		record.ResponseBody = ""
+		record.RewrittenResponse = ""
+		record.ResponseChunks = nil
+		record.ReconstructedResponse = ""
+		record.WSMessages = dropDirection(record.WSMessages, "server")
+	}
+}
+
+// dropDirection removes the websocket messages sent in one direction
+func dropDirection(messages []storage.WSMessage, direction string) []storage.WSMessage {
+	var kept []storage.WSMessage
+	for _, message := range messages {
+		if message.Direction != direction {
+			kept = append(kept, message)
+		}
 	}
+	return kept
 }
 
 // storageWorker processes records for storage
 func (g *Gateway) storageWorker() {
+	defer g.workerWG.Done()
 	for record := range g.workers {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		if err := g.store.Save(ctx, record); err != nil {
-			log.Printf("Failed to save record %s: %v", record.ID, err)
+		g.saveRecord(record)
+	}
+}
+
+// saveRecord saves an enqueued record, dead-lettering it on failure
+func (g *Gateway) saveRecord(record *storage.Record) {
+	// Time spent waiting for a free worker, rising values call for a
+	// larger worker_pool_size
+	record.StorageQueueMS = time.Since(record.EnqueuedAt).Milliseconds()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := g.store.Save(ctx, record); err != nil {
+		log.Printf("Failed to save record %s: %v", record.ID, err)
+		g.dead.add(record, err)
+	} else {
+		g.publish(record)
+	}
+	g.pending.Add(-1)
+}
+
+// Flush waits until every record handed to the storage workers has been
+// saved and then syncs the store to durable storage when it buffers writes
+func (g *Gateway) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for g.pending.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to drain storage queue: %w", ctx.Err())
+		case <-ticker.C:
 		}
-		cancel()
 	}
+
+	if flusher, ok := g.store.(storage.Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+	return nil
 }
 
 // Close shuts down the gateway
 func (g *Gateway) Close() error {
+	close(g.stop)
+	if g.spill != nil {
+		close(g.spillStop)
+		<-g.spillDone
+	}
 	close(g.workers)
+	g.workerWG.Wait()
+	if g.spill != nil {
+		g.saveSpilled()
+		g.spill.close()
+	}
+
+	for _, s := range g.sinks {
+		s.Close()
+	}
 	return g.store.Close()
 }
 
+// publish hands a saved record to every configured sink
+func (g *Gateway) publish(record *storage.Record) {
+	for _, s := range g.sinks {
+		s.Publish(record)
+	}
+}
+
 // streamCapture captures streaming response data
 type streamCapture struct {
 	reader  io.ReadCloser
 	buffer  *bytes.Buffer
 	chunks  *[]string
 	maxSize int64
+	flight  *inflight
 }
 
 func (sc *streamCapture) Read(p []byte) (n int, err error) {
 	n, err = sc.reader.Read(p)
-	if n > 0 {
+	if n > 0 && sc.flight.acquire() {
 		// Capture chunk if we haven't exceeded max size
 		if int64(sc.buffer.Len()) < sc.maxSize {
 			chunk := string(p[:n])
@@ -236,6 +917,9 @@ func (sc *streamCapture) Read(p []byte) (n int, err error) {
 			sc.buffer.Write(p[:n])
 		}
 	}
+	if n > 0 {
+		sc.flight.release()
+	}
 	return n, err
 }
 
@@ -243,21 +927,167 @@ func (sc *streamCapture) Close() error {
 	return sc.reader.Close()
 }
 
+// upstreamTimer measures the time between the request being written upstream
+// and the first response byte arriving, and the whole upstream exchange.
+// Trace hooks fire on transport goroutines, so timestamps are stored
+// atomically.
+type upstreamTimer struct {
+	sent      atomic.Int64
+	firstByte atomic.Int64
+	started   atomic.Int64
+	finished  atomic.Int64
+}
+
+// wrap times the exchange through base, from sending the request until the
+// response body is read to the end or closed, across all retry attempts
+func (ut *upstreamTimer) wrap(base http.RoundTripper) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		ut.started.CompareAndSwap(0, time.Now().UnixNano())
+		resp, err := base.RoundTrip(req)
+		if err != nil || resp.StatusCode == http.StatusSwitchingProtocols {
+			// Upgraded connections keep their writable body for the proxy
+			ut.finish()
+			return resp, err
+		}
+		resp.Body = &timedBody{ReadCloser: resp.Body, timer: ut}
+		return resp, nil
+	})
+}
+
+// finish marks the end of the upstream exchange
+func (ut *upstreamTimer) finish() {
+	ut.finished.CompareAndSwap(0, time.Now().UnixNano())
+}
+
+// exchange returns the time spent on the upstream exchange, including
+// uploading the request, retries and their backoff, and reading the whole
+// response body, or zero when it never started
+func (ut *upstreamTimer) exchange() time.Duration {
+	started, finished := ut.started.Load(), ut.finished.Load()
+	if started == 0 {
+		return 0
+	}
+	if finished == 0 {
+		finished = time.Now().UnixNano()
+	}
+	return time.Duration(finished - started)
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// timedBody ends the upstream exchange once the body is drained or closed
+type timedBody struct {
+	io.ReadCloser
+	timer *upstreamTimer
+}
+
+func (tb *timedBody) Read(p []byte) (int, error) {
+	n, err := tb.ReadCloser.Read(p)
+	if err == io.EOF {
+		tb.timer.finish()
+	}
+	return n, err
+}
+
+func (tb *timedBody) Close() error {
+	tb.timer.finish()
+	return tb.ReadCloser.Close()
+}
+
+func (ut *upstreamTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			ut.sent.Store(time.Now().UnixNano())
+		},
+		GotFirstResponseByte: func() {
+			ut.firstByte.Store(time.Now().UnixNano())
+		},
+	}
+}
+
+// latency returns the measured upstream latency, or zero when either event
+// was not observed
+func (ut *upstreamTimer) latency() time.Duration {
+	sent, firstByte := ut.sent.Load(), ut.firstByte.Load()
+	if sent == 0 || firstByte < sent {
+		return 0
+	}
+	return time.Duration(firstByte - sent)
+}
+
+// teeBody reads through a wrapping reader while closing the original body
+type teeBody struct {
+	reader io.Reader
+	closer io.Closer
+}
+
+func (tb *teeBody) Read(p []byte) (n int, err error) {
+	return tb.reader.Read(p)
+}
+
+func (tb *teeBody) Close() error {
+	return tb.closer.Close()
+}
+
+// cappedBuffer is a concurrency-safe buffer that silently discards writes
+// beyond maxSize. The transport may still be writing the request body from
+// its own goroutine when the proxy returns, hence the mutex.
+type cappedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	maxSize   int64
+	truncated bool
+}
+
+func (cb *cappedBuffer) Write(p []byte) (int, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	remaining := cb.maxSize - int64(cb.buf.Len())
+	if int64(len(p)) > remaining {
+		cb.truncated = true
+		if remaining > 0 {
+			cb.buf.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+
+	cb.buf.Write(p)
+	return len(p), nil
+}
+
+// contents returns the captured data and whether anything was discarded
+func (cb *cappedBuffer) contents() (string, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.buf.String(), cb.truncated
+}
+
 // bodyCapture wraps a reader to execute a callback on close
 type bodyCapture struct {
 	reader  io.ReadCloser
-	onClose func()
+	onClose func(readErr error)
 	closed  bool
+	readErr error
 }
 
 func (bc *bodyCapture) Read(p []byte) (n int, err error) {
-	return bc.reader.Read(p)
+	n, err = bc.reader.Read(p)
+	if err != nil && err != io.EOF && bc.readErr == nil {
+		bc.readErr = err
+	}
+	return n, err
 }
 
 func (bc *bodyCapture) Close() error {
 	if !bc.closed {
 		bc.closed = true
-		bc.onClose()
+		bc.onClose(bc.readErr)
 	}
 	return bc.reader.Close()
 }
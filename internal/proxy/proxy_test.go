@@ -0,0 +1,317 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"openailogger/internal/config"
+	"openailogger/storage"
+	"openailogger/storage/memory"
+)
+
+// newTestGateway serves a gateway with a single route mounted at /test in
+// front of upstream, storing into store (a memory store when nil). The
+// route keeps any other settings of cfg.Routes["test"].
+func newTestGateway(t *testing.T, cfg *config.Config, store storage.Store, upstream http.Handler) (*Gateway, *httptest.Server) {
+	t.Helper()
+
+	backend := httptest.NewServer(upstream)
+	t.Cleanup(backend.Close)
+
+	if cfg.Capture.MaxBodyMB == 0 {
+		cfg.Capture.MaxBodyMB = 1
+	}
+	if cfg.Capture.WorkerPoolSize == 0 {
+		cfg.Capture.WorkerPoolSize = 1
+	}
+	route := cfg.Routes["test"]
+	route.Mount, route.Upstream = "/test", backend.URL
+	cfg.Routes = map[string]config.RouteConfig{"test": route}
+	if store == nil {
+		store = memory.New()
+	}
+
+	g := New(cfg, store)
+	server := httptest.NewServer(g)
+	t.Cleanup(func() {
+		server.Close()
+		g.Close()
+	})
+	return g, server
+}
+
+// storedRecords waits for the storage workers and returns every record
+func storedRecords(t *testing.T, g *Gateway) []storage.Record {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := g.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	records, _, err := g.store.List(ctx, storage.Query{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return records
+}
+
+// do sends a request to the gateway and drains the response
+func do(t *testing.T, req *http.Request) *http.Response {
+	t.Helper()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestOversizedRequestBodyForwardedIntact(t *testing.T) {
+	received := make(chan []byte, 1)
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+		w.Write([]byte("{}"))
+	})
+
+	cfg := &config.Config{}
+	cfg.Capture.MaxRequestBodyMB = 1
+	g, server := newTestGateway(t, cfg, nil, upstream)
+
+	sent := bytes.Repeat([]byte("0123456789"), (1<<20)/10+100)
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/test/v1/files", bytes.NewReader(sent))
+	do(t, req)
+
+	if got := <-received; !bytes.Equal(got, sent) {
+		t.Fatalf("upstream received %d bytes, want the %d sent intact", len(got), len(sent))
+	}
+
+	records := storedRecords(t, g)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	record := records[0]
+	if !record.RequestTruncated {
+		t.Error("RequestTruncated = false, want true")
+	}
+	if got, want := int64(len(record.RequestBody)), cfg.MaxRequestBodyBytes(); got != want {
+		t.Errorf("captured %d bytes, want the cap of %d", got, want)
+	}
+	if record.SizeReqBytes != int64(len(sent)) {
+		t.Errorf("SizeReqBytes = %d, want %d", record.SizeReqBytes, len(sent))
+	}
+}
+
+func TestRequestSizeOnEarlyReturns(t *testing.T) {
+	body := strings.Repeat("x", 2<<20)
+	tests := []struct {
+		name     string
+		cfg      func(*config.Config)
+		requests int
+	}{
+		{
+			name: "cache hit",
+			cfg: func(cfg *config.Config) {
+				cfg.Capture.MaxBodyMB = 4
+				cfg.Capture.MaxRequestBodyMB = 4
+				cfg.Routes = map[string]config.RouteConfig{"test": {Cache: config.CacheConfig{Enabled: true}}}
+			},
+			requests: 2,
+		},
+		{
+			name: "rejected as oversized",
+			cfg: func(cfg *config.Config) {
+				cfg.Capture.MaxRequestBodyMB = 1
+				cfg.Capture.OnOversize = "reject"
+			},
+			requests: 1,
+		},
+		{
+			name: "method not allowed",
+			cfg: func(cfg *config.Config) {
+				cfg.Routes = map[string]config.RouteConfig{"test": {AllowedMethods: []string{http.MethodGet}}}
+			},
+			requests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			tt.cfg(cfg)
+			g, server := newTestGateway(t, cfg, nil, okUpstream)
+
+			for i := 0; i < tt.requests; i++ {
+				req, _ := http.NewRequest(http.MethodPost, server.URL+"/test/v1/embeddings", strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				do(t, req)
+			}
+
+			records := storedRecords(t, g)
+			if len(records) != tt.requests {
+				t.Fatalf("got %d records, want %d", len(records), tt.requests)
+			}
+			for _, record := range records {
+				if record.SizeReqBytes != int64(len(body)) {
+					t.Errorf("record %s SizeReqBytes = %d, want %d", record.ID, record.SizeReqBytes, len(body))
+				}
+			}
+		})
+	}
+}
+
+func TestPatchRequestCaptured(t *testing.T) {
+	forwarded := make(chan string, 1)
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded <- r.Header.Get(metaHeader)
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte(`{"id":"ft-1"}`))
+	})
+	g, server := newTestGateway(t, &config.Config{}, nil, upstream)
+
+	body := `{"model":"gpt-4o-mini","suffix":"v2"}`
+	req, _ := http.NewRequest(http.MethodPatch, server.URL+"/test/v1/fine_tuning/jobs/ft-1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(metaHeader, "team=nlp;ticket=42")
+	do(t, req)
+
+	if meta := <-forwarded; meta != "" {
+		t.Errorf("upstream received %s %q, want it stripped", metaHeader, meta)
+	}
+
+	records := storedRecords(t, g)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	record := records[0]
+	if record.Method != http.MethodPatch {
+		t.Errorf("Method = %q, want PATCH", record.Method)
+	}
+	if record.RequestBody != body {
+		t.Errorf("RequestBody = %q, want %q", record.RequestBody, body)
+	}
+	if record.ModelHint != "gpt-4o-mini" {
+		t.Errorf("ModelHint = %q, want gpt-4o-mini", record.ModelHint)
+	}
+	if record.Metadata["team"] != "nlp" || record.Metadata["ticket"] != "42" {
+		t.Errorf("Metadata = %v, want team=nlp and ticket=42", record.Metadata)
+	}
+}
+
+func TestOptedOutRewriteFailure(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-No-Log", "true")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte(`{"id":`)) // Cut short of the declared length
+	})
+
+	cfg := &config.Config{}
+	cfg.Capture.NoLogHeader = "X-No-Log"
+	cfg.Routes = map[string]config.RouteConfig{
+		"test": {ResponseRewrite: map[string]interface{}{"id": "rewritten"}},
+	}
+	g, server := newTestGateway(t, cfg, nil, upstream)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/test/v1/models", nil)
+	if resp := do(t, req); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+	if records := storedRecords(t, g); len(records) != 0 {
+		t.Errorf("got %d records, want the opted out exchange uncaptured", len(records))
+	}
+}
+
+func TestMetadataStrippedFromSkippedRequests(t *testing.T) {
+	forwarded := make(chan string, 1)
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded <- r.Header.Get(metaHeader)
+	})
+	g, server := newTestGateway(t, &config.Config{}, nil, upstream)
+
+	req, _ := http.NewRequest(http.MethodOptions, server.URL+"/test/v1/chat/completions", nil)
+	req.Header.Set(metaHeader, "team=nlp")
+	do(t, req)
+
+	if meta := <-forwarded; meta != "" {
+		t.Errorf("upstream received %s %q, want it stripped", metaHeader, meta)
+	}
+	if records := storedRecords(t, g); len(records) != 0 {
+		t.Errorf("got %d records, want the preflight uncaptured", len(records))
+	}
+}
+
+func TestTitleMasked(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Capture.Masks = []config.MaskConfig{{Name: "email"}}
+	cfg.Routes = map[string]config.RouteConfig{"test": {TitleField: "user"}}
+	g, server := newTestGateway(t, cfg, nil, okUpstream)
+
+	body := `{"model":"gpt-4o","user":"jane@example.com"}`
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/test/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	do(t, req)
+
+	records := storedRecords(t, g)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	if title := records[0].Title; strings.Contains(title, "jane@example.com") {
+		t.Errorf("Title = %q, want the email masked", title)
+	}
+}
+
+func TestOversizedHeadersTruncated(t *testing.T) {
+	huge := strings.Repeat("x", 4096)
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Huge", huge)
+		w.Header().Set("A-Small", "kept")
+		w.Write([]byte("{}"))
+	})
+
+	cfg := &config.Config{}
+	cfg.Capture.CaptureHeaders = true
+	cfg.Capture.MaxHeaderKB = 1
+	g, server := newTestGateway(t, cfg, nil, upstream)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/test/v1/models", nil)
+	req.Header.Set("X-Huge-Request", huge)
+	resp := do(t, req)
+	if resp.Header.Get("X-Huge") != huge {
+		t.Error("client didn't receive the oversized header intact")
+	}
+
+	records := storedRecords(t, g)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	for direction, headers := range map[string]map[string][]string{
+		"request":  records[0].RequestHeaders,
+		"response": records[0].ResponseHeaders,
+	} {
+		size := 0
+		for name, values := range headers {
+			for _, value := range values {
+				size += len(name) + len(value)
+			}
+		}
+		if int64(size) > cfg.MaxHeaderBytes()+64 {
+			t.Errorf("%s headers hold %d bytes, want about the %d byte cap", direction, size, cfg.MaxHeaderBytes())
+		}
+		if len(headers[truncatedHeaderKey]) == 0 {
+			t.Errorf("%s headers lack the %s marker", direction, truncatedHeaderKey)
+		}
+	}
+	if got := records[0].ResponseHeaders["A-Small"]; len(got) != 1 || got[0] != "kept" {
+		t.Errorf("A-Small = %v, want headers under the cap kept", got)
+	}
+}
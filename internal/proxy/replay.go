@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"openailogger/storage"
+)
+
+// replayHeaders lists the headers of the replay API call forwarded to the
+// upstream: credentials, content negotiation, provider versions and the
+// gateway's capture headers. Anything else, e.g. cookies, stays behind.
+var replayHeaders = []string{
+	"Authorization", "Api-Key", "X-Api-Key", "X-Goog-Api-Key",
+	"Content-Type", "Accept",
+	"OpenAI-Organization", "OpenAI-Project", "OpenAI-Beta",
+	"Anthropic-Version", "Anthropic-Beta",
+	ttlHeader, metaHeader,
+}
+
+// ErrInvalidOverrides is returned when replay overrides cannot be merged
+// into the original request body
+var ErrInvalidOverrides = errors.New("invalid replay overrides")
+
+// ErrNotReplayable is returned when the stored request body isn't the
+// request that was sent, which replaying would corrupt
+var ErrNotReplayable = errors.New("record can't be replayed")
+
+// ReplayOptions adjusts how a captured request is replayed
+type ReplayOptions struct {
+	// Overrides is a JSON object merged into the original request body
+	Overrides json.RawMessage
+	// Header is sent upstream with the replayed request, limited to the
+	// replayHeaders and the gateway token. Headers are never captured with
+	// the original, so upstream credentials come from here.
+	Header http.Header
+	// Timestamp overrides the replayed record's time, e.g. the original's
+	// for backfills and deterministic fixtures. Nil uses the current time.
+	Timestamp *time.Time
+}
+
+// Replay re-sends a captured request through the gateway and stores the new
+// record synchronously
+func (g *Gateway) Replay(ctx context.Context, original *storage.Record, opts ReplayOptions) (*storage.Record, error) {
+	if err := replayable(original); err != nil {
+		return nil, err
+	}
+
+	body := original.RequestBody
+	if len(opts.Overrides) > 0 {
+		merged, err := mergeJSON(body, opts.Overrides)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidOverrides, err)
+		}
+		body = merged
+	}
+
+	req, err := http.NewRequestWithContext(ctx, original.Method, original.URL, strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build replay request: %w", err)
+	}
+
+	names := replayHeaders
+	if auth, ok := g.auth.(*tokenAuthenticator); ok {
+		names = append(names[:len(names):len(names)], auth.header)
+	}
+	for _, name := range names {
+		for _, value := range opts.Header.Values(name) {
+			req.Header.Add(name, value)
+		}
+	}
+	if req.Header.Get("Content-Type") == "" && body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rw := &replayResponseWriter{header: make(http.Header)}
+	record := g.serve(rw, req)
+	if record == nil {
+		return nil, fmt.Errorf("replay was rejected with status %d", rw.status)
+	}
+
+	record.ReplayOf = original.ID
+	if opts.Timestamp != nil {
+		record.Timestamp = opts.Timestamp.UTC().Truncate(g.config.Capture.TimestampResolution())
+	}
+	if len(opts.Overrides) > 0 {
+		record.ReplayOverrides = opts.Overrides
+	}
+	if err := g.store.Save(ctx, record); err != nil {
+		return nil, fmt.Errorf("failed to save replay record: %w", err)
+	}
+	g.publish(record)
+
+	return record, nil
+}
+
+// replayable reports why the stored request body of a record differs from
+// the request that was sent, nil when it can be replayed
+func replayable(record *storage.Record) error {
+	var reason string
+	switch {
+	case record.RequestTruncated:
+		reason = "the request body was truncated"
+	case record.BodyEncoding != "":
+		reason = "the request body is an encoded preview"
+	case isSampled(record.RequestBody):
+		reason = "the request body was sampled"
+	case len(record.Redactions) > 0:
+		reason = "the captured bodies were masked"
+	case strippedImagePattern.MatchString(record.RequestBody):
+		reason = "images were stripped from the request body"
+	case strings.HasPrefix(record.RequestBody, batchUploadPlaceholder):
+		reason = "the batch input file wasn't stored"
+	case record.RequestBody == "" && record.SizeReqBytes > 0:
+		reason = "the request body wasn't retained"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNotReplayable, reason)
+}
+
+// mergeJSON applies overrides to a JSON object body following JSON merge
+// patch semantics: objects merge recursively and null removes a field
+func mergeJSON(body string, overrides json.RawMessage) (string, error) {
+	var patch map[string]interface{}
+	if err := json.Unmarshal(overrides, &patch); err != nil {
+		return "", fmt.Errorf("overrides must be a JSON object")
+	}
+
+	var target map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &target); err != nil || target == nil {
+		return "", fmt.Errorf("original request body is not a JSON object")
+	}
+
+	merged, err := json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return "", err
+	}
+	return string(merged), nil
+}
+
+// mergePatch merges patch into target in place
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		patchObj, isObj := value.(map[string]interface{})
+		targetObj, targetIsObj := target[key].(map[string]interface{})
+		if isObj && targetIsObj {
+			target[key] = mergePatch(targetObj, patchObj)
+		} else {
+			target[key] = value
+		}
+	}
+	return target
+}
+
+// replayResponseWriter discards the proxied response, which is captured on
+// the record anyway
+type replayResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (rw *replayResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *replayResponseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	return len(p), nil
+}
+
+func (rw *replayResponseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+}
+
+func (rw *replayResponseWriter) Flush() {}
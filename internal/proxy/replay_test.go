@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"openailogger/internal/config"
+	"openailogger/storage"
+)
+
+func TestReplayForwardsAllowedHeaders(t *testing.T) {
+	forwarded := make(chan http.Header, 1)
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded <- r.Header.Clone()
+		w.Write([]byte("{}"))
+	})
+	g, _ := newTestGateway(t, &config.Config{}, nil, upstream)
+
+	original := &storage.Record{
+		ID:           "original",
+		Method:       http.MethodPost,
+		URL:          "/test/v1/chat/completions",
+		RequestBody:  `{"model":"gpt-4o"}`,
+		SizeReqBytes: 18,
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer sk-test")
+	header.Set("OpenAI-Beta", "assistants=v2")
+	header.Set("Cookie", "session=secret")
+	header.Set("X-Forwarded-For", "10.0.0.1")
+
+	record, err := g.Replay(context.Background(), original, ReplayOptions{Header: header})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if record.ReplayOf != "original" {
+		t.Errorf("ReplayOf = %q, want original", record.ReplayOf)
+	}
+
+	got := <-forwarded
+	for _, name := range []string{"Authorization", "OpenAI-Beta"} {
+		if got.Get(name) != header.Get(name) {
+			t.Errorf("upstream received %s %q, want %q", name, got.Get(name), header.Get(name))
+		}
+	}
+	if got.Get("Cookie") != "" {
+		t.Errorf("upstream received Cookie %q, want it dropped", got.Get("Cookie"))
+	}
+}
+
+func TestReplayRejectsAlteredBodies(t *testing.T) {
+	tests := []struct {
+		name   string
+		record storage.Record
+	}{
+		{"truncated", storage.Record{RequestBody: `{"model":`, RequestTruncated: true}},
+		{"sampled", storage.Record{RequestBody: "{\"a\":\n...[100 bytes omitted]...\n\"b\"}"}},
+		{"masked", storage.Record{RequestBody: `{"user":"[MASKED]"}`, Redactions: map[string]int{"email": 1}}},
+		{"images stripped", storage.Record{RequestBody: `{"url":"[image: 2048 bytes, image/png]"}`}},
+		{"batch placeholder", storage.Record{RequestBody: "[batch input file: 3 lines, 512 bytes omitted]"}},
+		{"not retained", storage.Record{SizeReqBytes: 42}},
+	}
+
+	g := &Gateway{config: &config.Config{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := tt.record
+			original.Method, original.URL = http.MethodPost, "/test/v1/chat/completions"
+			if _, err := g.Replay(context.Background(), &original, ReplayOptions{}); !errors.Is(err, ErrNotReplayable) {
+				t.Errorf("Replay = %v, want ErrNotReplayable", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"openailogger/internal/config"
+	"openailogger/storage"
+)
+
+const (
+	// retryBaseDelay is the first backoff, doubled on every further attempt
+	retryBaseDelay = 500 * time.Millisecond
+	// maxBackoffShift bounds the doublings, far beyond retryMaxDelay
+	maxBackoffShift = 16
+	// retryMaxDelay caps both the backoff and honored Retry-After values
+	retryMaxDelay = 30 * time.Second
+)
+
+// retryTransport resends a request to the same upstream while it answers
+// with one of the configured statuses, replaying the captured request body
+type retryTransport struct {
+	base     http.RoundTripper
+	route    config.RouteConfig
+	body     []byte
+	record   *storage.Record
+	maxTries int
+}
+
+// newRetryTransport returns a transport retrying per the route's
+// retry_on_status by replaying body, or nil when retries are off or the body
+// can't be replayed
+func (g *Gateway) newRetryTransport(route config.RouteConfig, record *storage.Record, body string, teeing bool) http.RoundTripper {
+	if len(route.RetryOnStatus) == 0 || teeing || record.RequestTruncated {
+		return nil
+	}
+	return &retryTransport{
+		base:     g.transport,
+		route:    route,
+		body:     []byte(body),
+		record:   record,
+		maxTries: route.MaxRetryCount() + 1,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		// Every attempt gets its own request, the transport may still hold
+		// on to the previous one
+		attemptReq := req.Clone(req.Context())
+		if req.Body != nil && req.Body != http.NoBody {
+			attemptReq.Body = io.NopCloser(bytes.NewReader(t.body))
+			attemptReq.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(t.body)), nil
+			}
+		}
+
+		flight := inflightFrom(req.Context())
+		if flight.acquire() {
+			t.record.Attempts = attempt
+		}
+		flight.release()
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		if err != nil || attempt >= t.maxTries || !t.retryable(resp.StatusCode) {
+			return resp, err
+		}
+
+		delay := retryDelay(resp, attempt)
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether status is listed in retry_on_status
+func (t *retryTransport) retryable(status int) bool {
+	for _, s := range t.route.RetryOnStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay honors Retry-After in seconds or as an HTTP date, otherwise
+// backs off exponentially
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	// Past the cap the shift would only overflow
+	delay := retryMaxDelay
+	if attempt-1 < maxBackoffShift {
+		delay = retryBaseDelay << (attempt - 1)
+	}
+
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(value); err == nil {
+			delay = time.Until(at)
+		}
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, retryBaseDelay},
+		{2, 2 * retryBaseDelay},
+		{4, 8 * retryBaseDelay},
+		{10, retryMaxDelay},
+		{36, retryMaxDelay},
+		{100, retryMaxDelay},
+	}
+
+	resp := &http.Response{Header: http.Header{}}
+	for _, tt := range tests {
+		if got := retryDelay(resp, tt.attempt); got != tt.want {
+			t.Errorf("retryDelay(attempt %d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"openailogger/internal/config"
+	"openailogger/storage"
+)
+
+// rewriteResponse applies the route's response_rewrite overrides to a
+// non-streaming JSON response before it is returned to the client. The
+// original body is captured on the record and the rewritten one noted
+// alongside it. Returns false when the response was left untouched.
+func (g *Gateway) rewriteResponse(resp *http.Response, route config.RouteConfig, record *storage.Record) (bool, error) {
+	if len(route.ResponseRewrite) == 0 || resp.Body == nil || resp.Header.Get("Content-Encoding") != "" {
+		return false, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return false, nil
+	}
+
+	original, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return false, fmt.Errorf("failed to read response for rewrite: %w", err)
+	}
+
+	rewritten, err := applyRewrites(original, route.ResponseRewrite)
+	if err != nil {
+		// Not a rewritable document, pass the original through untouched
+		rewritten = original
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(rewritten))
+	resp.ContentLength = int64(len(rewritten))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(rewritten)))
+
+	if record != nil {
+		captured := original
+		if max := g.config.MaxResponseBodyBytes(); int64(len(captured)) > max {
+			captured = captured[:max]
+		}
+		record.ResponseBody = string(captured)
+		record.SizeResBytes = int64(len(original))
+		if err == nil {
+			record.RewrittenResponse = string(rewritten)
+		}
+	}
+
+	return true, nil
+}
+
+// rewriteModel replaces the requested model per the route's model_rewrite
+// before the request is forwarded and returns the forwarded body. The
+// captured body keeps the requested model, the record notes the effective
+// one. Truncated captures can't be rewritten and are forwarded as is.
+func (g *Gateway) rewriteModel(r *http.Request, route config.RouteConfig, record *storage.Record) (string, bool) {
+	if len(route.ModelRewrite) == 0 || record.RequestBody == "" {
+		return "", false
+	}
+	if record.RequestTruncated {
+		log.Printf("Request body for %s is too large to rewrite its model", record.ID)
+		return "", false
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(record.RequestBody))
+	decoder.UseNumber() // Forward numbers exactly as sent
+	var body map[string]interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return "", false
+	}
+	requested, _ := body["model"].(string)
+	effective, ok := route.ModelRewrite[requested]
+	if !ok {
+		return "", false
+	}
+
+	body["model"] = effective
+	rewritten, err := json.Marshal(body)
+	if err != nil {
+		return "", false
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(rewritten))
+	r.ContentLength = int64(len(rewritten))
+	r.Header.Set("Content-Length", strconv.Itoa(len(rewritten)))
+	record.EffectiveModel = effective
+	return string(rewritten), true
+}
+
+// applyRewrites sets each dotted path (array elements by index, e.g.
+// "choices.0.finish_reason") in the JSON document to its override value
+func applyRewrites(body []byte, rewrites map[string]interface{}) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(rewrites))
+	for path := range rewrites {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := setPath(doc, strings.Split(path, "."), rewrites[path]); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+// setPath sets the value at path inside doc, creating missing object keys
+// for the last segment only
+func setPath(doc interface{}, path []string, value interface{}) error {
+	key := path[0]
+	last := len(path) == 1
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if last {
+			node[key] = value
+			return nil
+		}
+		child, ok := node[key]
+		if !ok {
+			return fmt.Errorf("field %q not found", key)
+		}
+		return setPath(child, path[1:], value)
+	case []interface{}:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(node) {
+			return fmt.Errorf("index %q out of range", key)
+		}
+		if last {
+			node[index] = value
+			return nil
+		}
+		return setPath(node[index], path[1:], value)
+	default:
+		return fmt.Errorf("cannot descend into %q", key)
+	}
+}
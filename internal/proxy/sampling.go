@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"unicode/utf8"
+
+	"openailogger/storage"
+)
+
+// keepRecord decides whether a completed record is stored under sampling.
+// Errors, slow and token-heavy records are kept when configured, the rest
+// at the sample rate.
+func (g *Gateway) keepRecord(record *storage.Record) bool {
+	sampling := g.config.Capture.Sampling
+	rate := sampling.Rate()
+	if rate >= 1 {
+		return true
+	}
+
+	switch {
+	case sampling.KeepErrors && (record.Error != nil || record.Status == 0 || record.Status >= 400):
+		return true
+	case sampling.KeepSlowerThanMS > 0 && record.DurationMS > sampling.KeepSlowerThanMS:
+		return true
+	case sampling.KeepAboveTokens > 0 && record.Usage != nil && record.Usage.TotalTokens > sampling.KeepAboveTokens:
+		return true
+	}
+	return rand.Float64() < rate
+}
+
+// sampleBodies replaces large captured bodies with their head and tail when
+// head_tail sampling is enabled. Runs after extraction so parsers still see
+// the full bodies.
+func (g *Gateway) sampleBodies(record *storage.Record) {
+	if g.config.Capture.BodySampling != "head_tail" {
+		return
+	}
+
+	head, tail := g.config.SampleHeadBytes(), g.config.SampleTailBytes()
+	record.RequestBody = headTail(record.RequestBody, head, tail)
+	record.ResponseBody = headTail(record.ResponseBody, head, tail)
+	record.ResponseChunks = headTailChunks(record.ResponseChunks, head, tail)
+}
+
+// headTail keeps the first head and last tail bytes of s with a gap marker
+// in between, cutting on UTF-8 boundaries
+func headTail(s string, head, tail int) string {
+	if len(s) <= head+tail {
+		return s
+	}
+
+	headEnd := head
+	for headEnd > 0 && !utf8.RuneStart(s[headEnd]) {
+		headEnd--
+	}
+	tailStart := len(s) - tail
+	for tailStart < len(s) && !utf8.RuneStart(s[tailStart]) {
+		tailStart++
+	}
+
+	return fmt.Sprintf("%s\n...[%d bytes omitted]...\n%s", s[:headEnd], tailStart-headEnd, s[tailStart:])
+}
+
+// sampledMarker matches the gap marker headTail leaves in sampled bodies
+var sampledMarker = regexp.MustCompile(`\n\.\.\.\[\d+ bytes omitted\]\.\.\.\n`)
+
+// isSampled reports whether a body was cut by head/tail sampling
+func isSampled(body string) bool {
+	return sampledMarker.MatchString(body)
+}
+
+// headTailChunks keeps whole chunks from the start and end of a stream until
+// the head and tail budgets are used up
+func headTailChunks(chunks []string, head, tail int) []string {
+	total := 0
+	for _, chunk := range chunks {
+		total += len(chunk)
+	}
+	if total <= head+tail {
+		return chunks
+	}
+
+	first, size := 0, 0
+	for first < len(chunks) && size+len(chunks[first]) <= head {
+		size += len(chunks[first])
+		first++
+	}
+
+	last, size := len(chunks), 0
+	for last > first && size+len(chunks[last-1]) <= tail {
+		size += len(chunks[last-1])
+		last--
+	}
+
+	sampled := make([]string, 0, first+len(chunks)-last)
+	sampled = append(sampled, chunks[:first]...)
+	return append(sampled, chunks[last:]...)
+}
@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"openailogger/storage"
+)
+
+// spillQueue is a disk-backed overflow for records that find the storage
+// worker queue full. Records are appended as JSON lines and read back in
+// order, one at a time, so a long burst costs disk rather than memory.
+type spillQueue struct {
+	mu     sync.Mutex
+	file   *os.File
+	offset int64 // start of the next record to drain
+	size   int64
+	ready  chan struct{}
+}
+
+// openSpillQueue opens or creates the overflow file and returns the queue
+// with the number of records left over from a previous run. Only records
+// peek can decode are counted, as it skips the others.
+func openSpillQueue(path string) (*spillQueue, int, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open overflow spill file: %w", err)
+	}
+
+	leftover := 0
+	var size int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var record storage.Record
+			if json.Unmarshal(line, &record) == nil {
+				leftover++
+			}
+			size += int64(len(line))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, 0, fmt.Errorf("failed to read overflow spill file: %w", err)
+		}
+	}
+
+	// Drop a torn line left by an interrupted write, appends would otherwise
+	// be glued to it
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to truncate overflow spill file: %w", err)
+	}
+
+	return &spillQueue{file: file, size: size, ready: make(chan struct{}, 1)}, leftover, nil
+}
+
+// push appends a record to the overflow file
+func (q *spillQueue) push(record *storage.Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+	line = append(line, '\n')
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.file.Write(line); err != nil {
+		// Keep a short write from being glued to the next record
+		q.file.Truncate(q.size)
+		return fmt.Errorf("failed to write overflow spill file: %w", err)
+	}
+	q.size += int64(len(line))
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// peek returns the oldest spilled record and the length of its line without
+// removing it, or nil once the file is drained. Undecodable lines are
+// skipped.
+func (q *spillQueue) peek() (*storage.Record, int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.offset < q.size {
+		reader := bufio.NewReader(io.NewSectionReader(q.file, q.offset, q.size-q.offset))
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			log.Printf("Failed to read overflow spill file: %v", err)
+			return nil, 0
+		}
+
+		var record storage.Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			log.Printf("Skipping unreadable record in overflow spill file: %v", err)
+			q.offset += int64(len(line))
+			continue
+		}
+		return &record, int64(len(line))
+	}
+
+	// Everything was handed over, start the file afresh
+	if q.size > 0 {
+		if err := q.file.Truncate(0); err != nil {
+			log.Printf("Failed to truncate overflow spill file: %v", err)
+			return nil, 0
+		}
+		q.offset, q.size = 0, 0
+	}
+	return nil, 0
+}
+
+// advance removes the record returned by the last peek
+func (q *spillQueue) advance(n int64) {
+	q.mu.Lock()
+	q.offset += n
+	q.mu.Unlock()
+}
+
+// close closes the overflow file, records not yet drained stay in it
+func (q *spillQueue) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.file.Close()
+}
+
+// drainSpill feeds spilled records back to the storage workers as the
+// queue frees up, until stop is closed
+func (g *Gateway) drainSpill(stop <-chan struct{}) {
+	defer close(g.spillDone)
+	for {
+		record, n := g.spill.peek()
+		if record == nil {
+			select {
+			case <-g.spill.ready:
+			case <-time.After(time.Second):
+			case <-stop:
+				return
+			}
+			continue
+		}
+
+		record.EnqueuedAt = time.Now()
+		if g.config.Capture.WorkerPoolSize <= 0 {
+			// Nothing reads the worker queue, save like enqueue does
+			g.saveRecord(record)
+			g.spill.advance(n)
+			continue
+		}
+		select {
+		case g.workers <- record:
+			g.spill.advance(n)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// saveSpilled stores the records still in the overflow file directly, once
+// the workers have stopped on shutdown
+func (g *Gateway) saveSpilled() {
+	for {
+		record, n := g.spill.peek()
+		if record == nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := g.store.Save(ctx, record); err != nil {
+			log.Printf("Failed to save spilled record %s: %v", record.ID, err)
+		} else {
+			g.publish(record)
+		}
+		cancel()
+		g.spill.advance(n)
+		g.pending.Add(-1)
+	}
+}
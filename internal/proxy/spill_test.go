@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"openailogger/internal/config"
+	"openailogger/storage"
+)
+
+func TestSpillRecoveryAfterTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spill.ndjson")
+	leftover := `{"id":"r1","provider":"test"}` + "\n" +
+		"not a record\n" +
+		`{"id":"r2","prov` // Cut short by a crash mid-append
+	if err := os.WriteFile(path, []byte(leftover), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Capture.OverflowSpillPath = path
+	g, _ := newTestGateway(t, cfg, nil, okUpstream)
+
+	records := storedRecords(t, g)
+	if len(records) != 1 || records[0].ID != "r1" {
+		t.Fatalf("got %v, want only r1 recovered", records)
+	}
+	if pending := g.pending.Load(); pending != 0 {
+		t.Errorf("pending = %d after draining, want 0", pending)
+	}
+}
+
+func TestSpillAppendAfterTornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spill.ndjson")
+	if err := os.WriteFile(path, []byte(`{"id":"torn","prov`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	q, leftover, err := openSpillQueue(path)
+	if err != nil {
+		t.Fatalf("openSpillQueue: %v", err)
+	}
+	defer q.close()
+	if leftover != 0 {
+		t.Errorf("leftover = %d, want the torn line uncounted", leftover)
+	}
+
+	if err := q.push(&storage.Record{ID: "next"}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	record, _ := q.peek()
+	if record == nil || record.ID != "next" {
+		t.Errorf("peek = %+v, want the record pushed after reopening", record)
+	}
+}
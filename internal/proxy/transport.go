@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"openailogger/internal/config"
+)
+
+// newUpstreamTransport returns the transport used to reach upstreams, with
+// the configured dial and response header timeouts so a dead upstream fails
+// fast instead of holding the request open
+func newUpstreamTransport(cfg config.TransportConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if timeout := cfg.DialTimeoutDuration(); timeout > 0 {
+		dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+	}
+	transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeoutDuration()
+
+	return transport
+}
+
+// newGRPCTransport returns the transport used by gRPC routes. gRPC needs
+// HTTP/2 for its framing and trailers, over TLS or, for plain http
+// upstreams, with prior knowledge.
+func newGRPCTransport(cfg config.TransportConfig) *http.Transport {
+	transport := newUpstreamTransport(cfg)
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	transport.Protocols = protocols
+	return transport
+}
@@ -0,0 +1,285 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"openailogger/storage"
+)
+
+// isWebSocketUpgrade reports whether the request asks to switch to websockets
+func isWebSocketUpgrade(h http.Header) bool {
+	return strings.EqualFold(h.Get("Upgrade"), "websocket")
+}
+
+// captureWebSocket records the messages exchanged over an upgraded
+// connection. Payload bytes across both directions are capped at the body
+// limit, later messages keep their metadata only.
+func (g *Gateway) captureWebSocket(resp *http.Response, record *storage.Record) {
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return
+	}
+
+	capture := &wsCapture{
+		conn:   conn,
+		record: record,
+		flight: inflightFrom(resp.Request.Context()),
+		budget: g.config.MaxBodyBytes(),
+	}
+	capture.fromServer = &wsParser{onFrame: func(op byte, data []byte, size int64, partial bool) {
+		capture.add("server", op, data, size, partial)
+	}}
+	capture.fromClient = &wsParser{onFrame: func(op byte, data []byte, size int64, partial bool) {
+		capture.add("client", op, data, size, partial)
+	}}
+	resp.Body = capture
+}
+
+// wsCapture wraps the upstream connection of an upgraded exchange. Reads
+// carry server messages to the client, writes carry client messages
+// upstream. Both directions run on their own goroutines and append to the
+// record under the in-flight lock.
+type wsCapture struct {
+	conn       io.ReadWriteCloser
+	record     *storage.Record
+	flight     *inflight
+	budget     int64
+	fromServer *wsParser
+	fromClient *wsParser
+}
+
+func (wc *wsCapture) Read(p []byte) (int, error) {
+	n, err := wc.conn.Read(p)
+	if n > 0 {
+		wc.fromServer.feed(p[:n])
+		if wc.flight.acquire() {
+			wc.record.SizeResBytes += int64(n)
+		}
+		wc.flight.release()
+	}
+	return n, err
+}
+
+func (wc *wsCapture) Write(p []byte) (int, error) {
+	n, err := wc.conn.Write(p)
+	if n > 0 {
+		wc.fromClient.feed(p[:n])
+		if wc.flight.acquire() {
+			wc.record.SizeReqBytes += int64(n)
+		}
+		wc.flight.release()
+	}
+	return n, err
+}
+
+func (wc *wsCapture) Close() error {
+	return wc.conn.Close()
+}
+
+// add appends a complete message to the record
+func (wc *wsCapture) add(direction string, op byte, data []byte, size int64, partial bool) {
+	if !wc.flight.acquire() {
+		wc.flight.release()
+		return
+	}
+	defer wc.flight.release()
+
+	if int64(len(data)) > wc.budget {
+		data = data[:wc.budget]
+		partial = true
+	}
+	wc.budget -= int64(len(data))
+
+	message := storage.WSMessage{
+		Direction: direction,
+		Timestamp: time.Now().UTC(),
+		Type:      wsOpcodeName(op),
+		Size:      size,
+		Truncated: partial,
+	}
+	if op == wsOpText && utf8.Valid(data) {
+		message.Data = string(data)
+	} else if len(data) > 0 {
+		message.Data = base64.StdEncoding.EncodeToString(data)
+	}
+	wc.record.WSMessages = append(wc.record.WSMessages, message)
+}
+
+// Websocket opcodes (RFC 6455 section 5.2)
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// wsOpcodeName names an opcode for the record
+func wsOpcodeName(op byte) string {
+	switch op {
+	case wsOpText:
+		return "text"
+	case wsOpBinary:
+		return "binary"
+	case wsOpClose:
+		return "close"
+	case wsOpPing:
+		return "ping"
+	case wsOpPong:
+		return "pong"
+	default:
+		return "unknown"
+	}
+}
+
+// wsMaxMessageBytes caps the payload buffered per message, larger messages
+// are recorded truncated with their full size
+const wsMaxMessageBytes = 1024 * 1024
+
+// wsParser reassembles websocket messages from a byte stream fed in
+// arbitrary pieces, unmasking client frames and joining fragments
+type wsParser struct {
+	onFrame func(op byte, data []byte, size int64, partial bool)
+
+	header    []byte
+	remaining int64
+	fin       bool
+	opcode    byte
+	masked    bool
+	mask      [4]byte
+	maskPos   int
+	frame     []byte
+	frameSize int64
+
+	messageOp   byte
+	message     []byte
+	messageSize int64
+	partial     bool
+}
+
+// feed consumes the next bytes of the stream
+func (p *wsParser) feed(b []byte) {
+	for len(b) > 0 {
+		if p.remaining == 0 && !p.headerDone() {
+			need := p.headerLen() - len(p.header)
+			take := min(need, len(b))
+			p.header = append(p.header, b[:take]...)
+			b = b[take:]
+			if !p.headerDone() {
+				continue
+			}
+			p.startFrame()
+			if p.remaining == 0 {
+				p.endFrame()
+			}
+			continue
+		}
+
+		take := int(min(p.remaining, int64(len(b))))
+		chunk := b[:take]
+		b = b[take:]
+		p.remaining -= int64(take)
+
+		if room := wsMaxMessageBytes - len(p.frame); room > 0 {
+			keep := chunk[:min(room, len(chunk))]
+			start := len(p.frame)
+			p.frame = append(p.frame, keep...)
+			if p.masked {
+				for i := start; i < len(p.frame); i++ {
+					p.frame[i] ^= p.mask[(p.maskPos+i-start)%4]
+				}
+			}
+		}
+		p.maskPos = (p.maskPos + take) % 4
+
+		if p.remaining == 0 {
+			p.endFrame()
+		}
+	}
+}
+
+// headerLen returns the header length implied by the bytes seen so far
+func (p *wsParser) headerLen() int {
+	if len(p.header) < 2 {
+		return 2
+	}
+	n := 2
+	switch p.header[1] & 0x7F {
+	case 126:
+		n += 2
+	case 127:
+		n += 8
+	}
+	if p.header[1]&0x80 != 0 {
+		n += 4
+	}
+	return n
+}
+
+// headerDone reports whether a full frame header has been read
+func (p *wsParser) headerDone() bool {
+	return len(p.header) >= 2 && len(p.header) == p.headerLen()
+}
+
+// startFrame decodes the buffered header
+func (p *wsParser) startFrame() {
+	h := p.header
+	p.fin = h[0]&0x80 != 0
+	p.opcode = h[0] & 0x0F
+	p.masked = h[1]&0x80 != 0
+
+	offset := 2
+	switch length := int64(h[1] & 0x7F); length {
+	case 126:
+		p.remaining = int64(binary.BigEndian.Uint16(h[2:4]))
+		offset = 4
+	case 127:
+		p.remaining = int64(binary.BigEndian.Uint64(h[2:10]) & (1<<63 - 1))
+		offset = 10
+	default:
+		p.remaining = length
+	}
+	if p.masked {
+		copy(p.mask[:], h[offset:offset+4])
+	}
+
+	p.frameSize = p.remaining
+	p.frame = p.frame[:0]
+	p.maskPos = 0
+	p.header = p.header[:0]
+}
+
+// endFrame reports control frames immediately and data messages once their
+// final fragment arrived
+func (p *wsParser) endFrame() {
+	p.header = p.header[:0]
+	partial := int64(len(p.frame)) < p.frameSize
+
+	if p.opcode >= wsOpClose {
+		p.onFrame(p.opcode, append([]byte(nil), p.frame...), p.frameSize, partial)
+		return
+	}
+
+	if p.opcode != wsOpContinuation {
+		p.messageOp = p.opcode
+		p.message = p.message[:0]
+		p.messageSize = 0
+		p.partial = false
+	}
+	if room := wsMaxMessageBytes - len(p.message); room > 0 {
+		p.message = append(p.message, p.frame[:min(room, len(p.frame))]...)
+	}
+	p.messageSize += p.frameSize
+	p.partial = p.partial || partial || int64(len(p.message)) < p.messageSize
+
+	if p.fin {
+		p.onFrame(p.messageOp, append([]byte(nil), p.message...), p.messageSize, p.partial)
+	}
+}
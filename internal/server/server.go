@@ -1,13 +1,18 @@
 package server
 
 import (
+	"fmt"
+	"html"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 
 	"openailogger/internal/api"
 	"openailogger/internal/config"
 	"openailogger/internal/proxy"
 	"openailogger/storage"
+	"openailogger/ui"
 )
 
 // Server represents the main HTTP server
@@ -19,38 +24,94 @@ type Server struct {
 
 // New creates a new server instance
 func New(cfg *config.Config, store storage.Store) *Server {
+	gateway := proxy.New(cfg, store)
+	handler := api.New(cfg, store, gateway)
+	handler.SetHealthReporter(gateway)
 	return &Server{
 		config:  cfg,
-		gateway: proxy.New(cfg, store),
-		api:     api.New(store),
+		gateway: gateway,
+		api:     handler,
 	}
 }
 
 // Start starts the HTTP server
 func (s *Server) Start() error {
+	// Duplicate mounts would make the mux panic on registration
+	if err := s.config.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
 	mux := http.NewServeMux()
 
 	// Register API routes first
 	s.api.RegisterRoutes(mux)
 
-	// Register provider proxy routes before the catch-all static handler
-	for _, route := range s.config.Routes {
-		pattern := route.Mount + "/"
+	// Register provider proxy routes before the catch-all static handler,
+	// in mount order so the log is stable across restarts
+	for _, name := range s.config.RouteNames() {
+		route := s.config.Routes[name]
+		pattern := strings.TrimSuffix(route.Mount, "/") + "/"
 		mux.Handle(pattern, s.gateway)
-		log.Printf("Registered proxy route: %s -> %s", pattern, route.Upstream)
+		log.Printf("Registered proxy route: %s -> %s", pattern, strings.Join(route.UpstreamURLs(), ", "))
 	}
 
 	// Serve static UI files (this should be last as it's a catch-all)
-	staticHandler := http.FileServer(http.Dir("ui/"))
-	mux.Handle("/", staticHandler)
+	mux.Handle("/", s.staticHandler())
 
 	log.Printf("Starting server on %s", s.config.Address())
 	log.Printf("UI available at: http://%s", s.config.Address())
 	log.Printf("API available at: http://%s/api", s.config.Address())
 
-	return http.ListenAndServe(s.config.Address(), mux)
+	server := &http.Server{Addr: s.config.Address(), Handler: mux}
+	if s.config.HasGRPCRoutes() {
+		// gRPC clients speak HTTP/2 with prior knowledge to plain endpoints
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		server.Protocols = protocols
+	}
+
+	return server.ListenAndServe()
 }
 
+// staticHandler serves the embedded UI, or the configured on-disk directory
+// for development. A missing directory gets a placeholder page explaining
+// how to fix the setup.
+func (s *Server) staticHandler() http.Handler {
+	dir := s.config.Server.UIDir
+	if dir == "" {
+		return http.FileServer(http.FS(ui.Assets))
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		log.Printf("UI directory %q not found, serving placeholder page", dir)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" && r.URL.Path != "/index.html" {
+				http.Error(w, fmt.Sprintf("Not found (UI directory %q is missing)", dir), http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintf(w, missingUIPage, html.EscapeString(dir))
+		})
+	}
+
+	log.Printf("Serving UI from directory %q", dir)
+	return http.FileServer(http.Dir(dir))
+}
+
+// missingUIPage is shown at / when the UI directory cannot be found
+const missingUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8"><title>AI Capture Gateway</title></head>
+<body>
+<h1>AI Capture Gateway</h1>
+<p>The gateway is running, but the UI directory <code>%s</code> was not found.
+Fix <code>server.ui_dir</code> in the config, or remove it to use the UI built into the binary.</p>
+<p>The REST API is available at <a href="/api/requests">/api/requests</a>.</p>
+</body>
+</html>
+`
+
 // Close shuts down the server
 func (s *Server) Close() error {
 	return s.gateway.Close()
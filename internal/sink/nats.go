@@ -0,0 +1,182 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"openailogger/internal/config"
+	"openailogger/storage"
+)
+
+// NATS publishes records as JSON to a NATS subject using the core text
+// protocol. The connection is opened lazily and re-established after
+// failures, records published while it is down are dropped.
+type NATS struct {
+	config  config.SinkConfig
+	records chan []byte
+	done    chan struct{}
+	mu      sync.Mutex // Guards writer between messages and PONG replies
+	conn    net.Conn
+	writer  *bufio.Writer
+	retryAt time.Time
+}
+
+// NewNATS starts a NATS publisher for the given config
+func NewNATS(cfg config.SinkConfig) *NATS {
+	n := &NATS{
+		config:  cfg,
+		records: make(chan []byte, cfg.BufferSizeOrDefault()),
+		done:    make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// Publish queues a record for delivery
+func (n *NATS) Publish(record *storage.Record) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Failed to encode record %s for NATS: %v", record.ID, err)
+		return
+	}
+
+	select {
+	case n.records <- data:
+	default:
+		log.Printf("NATS buffer full, dropping record %s", record.ID)
+	}
+}
+
+// Close publishes queued records and closes the connection
+func (n *NATS) Close() error {
+	close(n.records)
+	<-n.done
+	return nil
+}
+
+// run writes queued records, flushing once the queue is empty
+func (n *NATS) run() {
+	defer close(n.done)
+	defer n.disconnect()
+
+	for data := range n.records {
+		if err := n.publish(data, len(n.records) == 0); err != nil {
+			log.Printf("Failed to publish record to NATS: %v", err)
+			n.disconnect()
+		}
+	}
+}
+
+// publish writes one PUB message, connecting first when needed
+func (n *NATS) publish(data []byte, flush bool) error {
+	if n.conn == nil {
+		if time.Now().Before(n.retryAt) {
+			return fmt.Errorf("not connected")
+		}
+		if err := n.connect(); err != nil {
+			n.retryAt = time.Now().Add(5 * time.Second)
+			return err
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, err := fmt.Fprintf(n.writer, "PUB %s %d\r\n%s\r\n", n.config.Subject, len(data), data); err != nil {
+		return err
+	}
+	if flush {
+		return n.writer.Flush()
+	}
+	return nil
+}
+
+// connect dials the server, reads its INFO and sends CONNECT with any
+// credentials from the URL
+func (n *NATS) connect() error {
+	u, err := url.Parse(n.config.URL)
+	if err != nil {
+		return fmt.Errorf("invalid NATS URL: %w", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO") {
+		conn.Close()
+		return fmt.Errorf("failed to read NATS server info: %v", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "name": "openailogger"}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			options["user"], options["pass"] = u.User.Username(), password
+		} else {
+			options["auth_token"] = u.User.Username()
+		}
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\n", connect); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	n.conn = conn
+	n.writer = bufio.NewWriter(conn)
+	go n.serverLoop(reader, n.writer)
+	return nil
+}
+
+// serverLoop answers server PINGs and logs protocol errors until the
+// connection closes
+func (n *NATS) serverLoop(reader *bufio.Reader, writer *bufio.Writer) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			n.mu.Lock()
+			writer.WriteString("PONG\r\n")
+			writer.Flush()
+			n.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			log.Printf("NATS server error: %s", strings.TrimSpace(line))
+		}
+	}
+}
+
+// disconnect drops the connection so the next publish reconnects
+func (n *NATS) disconnect() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn != nil {
+		n.writer.Flush()
+		n.conn.Close()
+		n.conn = nil
+		n.writer = nil
+	}
+}
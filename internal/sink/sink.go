@@ -0,0 +1,25 @@
+package sink
+
+import (
+	"fmt"
+
+	"openailogger/internal/config"
+	"openailogger/storage"
+)
+
+// Sink receives records once they have been saved. Publish must not block
+// storage, implementations buffer and drop when they fall behind.
+type Sink interface {
+	Publish(record *storage.Record)
+	Close() error
+}
+
+// New creates the message-queue sink selected by the config
+func New(cfg config.SinkConfig) (Sink, error) {
+	switch cfg.Type {
+	case "nats":
+		return NewNATS(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+	}
+}
@@ -0,0 +1,146 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"openailogger/internal/config"
+	"openailogger/storage"
+)
+
+// Webhook is a Sink forwarding saved records to an external HTTP endpoint in batches.
+// Publishing never blocks the caller: records are dropped when the buffer is
+// full, and failed batches are retried with backoff before being given up.
+type Webhook struct {
+	config  config.WebhookConfig
+	client  *http.Client
+	records chan json.RawMessage
+	done    chan struct{}
+}
+
+// NewWebhook starts a webhook publisher for the given config
+func NewWebhook(cfg config.WebhookConfig) *Webhook {
+	w := &Webhook{
+		config:  cfg,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		records: make(chan json.RawMessage, cfg.BufferSizeOrDefault()),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Publish queues a record for delivery
+func (w *Webhook) Publish(record *storage.Record) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Failed to encode record %s for webhook: %v", record.ID, err)
+		return
+	}
+
+	select {
+	case w.records <- data:
+	default:
+		log.Printf("Webhook buffer full, dropping record %s", record.ID)
+	}
+}
+
+// Close delivers queued records and stops the publisher
+func (w *Webhook) Close() error {
+	close(w.records)
+	<-w.done
+	return nil
+}
+
+// run collects records into batches, sent once full or when the flush
+// interval passes
+func (w *Webhook) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.config.FlushIntervalDuration())
+	defer ticker.Stop()
+
+	batchSize := w.config.BatchSizeOrDefault()
+	batch := make([]json.RawMessage, 0, batchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			w.deliver(batch)
+			batch = make([]json.RawMessage, 0, batchSize)
+		}
+	}
+
+	for {
+		select {
+		case record, ok := <-w.records:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// deliver posts a batch as a JSON array, retrying failures with exponential
+// backoff
+func (w *Webhook) deliver(batch []json.RawMessage) {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		log.Printf("Failed to encode webhook batch: %v", err)
+		return
+	}
+
+	delay := time.Second
+	attempts := w.config.MaxRetriesOrDefault() + 1
+	for attempt := 1; ; attempt++ {
+		err := w.post(body)
+		if err == nil {
+			return
+		}
+		if attempt >= attempts {
+			log.Printf("Giving up on webhook batch of %d records after %d attempts: %v", len(batch), attempt, err)
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post sends one request, treating 429 and 5xx responses as failures
+func (w *Webhook) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range w.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	if resp.StatusCode >= 400 {
+		log.Printf("Webhook rejected batch with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// CanonicalJSON returns body with object keys sorted and insignificant
+// whitespace removed, so reordered but equivalent documents compare equal.
+// Bodies that aren't JSON are returned unchanged.
+func CanonicalJSON(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber() // Keep numbers exactly as written
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil || decoder.More() {
+		return body
+	}
+
+	canonical, err := json.Marshal(doc)
+	if err != nil {
+		return body
+	}
+	return canonical
+}
+
+// RequestHash identifies a request by provider, method, URL and canonical
+// body, for deduplication
+func RequestHash(record *Record) string {
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(record.Provider), []byte(record.Method), []byte(record.URL), CanonicalJSON([]byte(record.RequestBody))} {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,81 @@
+package storage
+
+import "testing"
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"sorted keys", `{"b":1,"a":2}`, `{"a":2,"b":1}`},
+		{"nested objects", `{"z":{"y":1,"x":[{"d":1,"c":2}]}}`, `{"z":{"x":[{"c":2,"d":1}],"y":1}}`},
+		{"whitespace", "{\n  \"a\" : [1, 2]\n}", `{"a":[1,2]}`},
+		{"numbers kept as written", `{"n":1.50,"big":12345678901234567890}`, `{"big":12345678901234567890,"n":1.50}`},
+		{"not JSON", `model=gpt-4`, `model=gpt-4`},
+		{"trailing document", `{"a":1}{"b":2}`, `{"a":1}{"b":2}`},
+		{"empty", ``, ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(CanonicalJSON([]byte(tt.body))); got != tt.want {
+				t.Errorf("CanonicalJSON(%q) = %q, want %q", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestHash(t *testing.T) {
+	base := Record{Provider: "openai", Method: "POST", URL: "/openai/v1/chat/completions"}
+	with := func(change func(*Record)) Record {
+		r := base
+		change(&r)
+		return r
+	}
+
+	tests := []struct {
+		name  string
+		a, b  Record
+		equal bool
+	}{
+		{
+			name:  "reordered keys",
+			a:     with(func(r *Record) { r.RequestBody = `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}` }),
+			b:     with(func(r *Record) { r.RequestBody = `{"messages":[{"content":"hi","role":"user"}],"model":"gpt-4o"}` }),
+			equal: true,
+		},
+		{
+			name:  "reformatted",
+			a:     with(func(r *Record) { r.RequestBody = `{"model":"gpt-4o","n":2}` }),
+			b:     with(func(r *Record) { r.RequestBody = "{\n  \"n\": 2,\n  \"model\": \"gpt-4o\"\n}" }),
+			equal: true,
+		},
+		{
+			name:  "different values",
+			a:     with(func(r *Record) { r.RequestBody = `{"model":"gpt-4o"}` }),
+			b:     with(func(r *Record) { r.RequestBody = `{"model":"gpt-4o-mini"}` }),
+			equal: false,
+		},
+		{
+			name:  "reordered array",
+			a:     with(func(r *Record) { r.RequestBody = `{"stop":["a","b"]}` }),
+			b:     with(func(r *Record) { r.RequestBody = `{"stop":["b","a"]}` }),
+			equal: false,
+		},
+		{
+			name:  "different provider",
+			a:     with(func(r *Record) { r.RequestBody = `{}` }),
+			b:     with(func(r *Record) { r.RequestBody = `{}`; r.Provider = "azure" }),
+			equal: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if equal := RequestHash(&tt.a) == RequestHash(&tt.b); equal != tt.equal {
+				t.Errorf("hashes equal = %v, want %v", equal, tt.equal)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StreamNDJSON encodes records as newline-delimited JSON while the returned
+// reader is consumed, so an export never holds an encoded copy of every
+// record. Closing the reader or cancelling ctx stops the encoding.
+func StreamNDJSON(ctx context.Context, records []Record) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		encoder := json.NewEncoder(writer)
+		for i := range records {
+			if err := ctx.Err(); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			if err := encoder.Encode(&records[i]); err != nil {
+				writer.CloseWithError(fmt.Errorf("failed to encode record: %w", err))
+				return
+			}
+		}
+		writer.Close()
+	}()
+	return reader
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestStreamNDJSON(t *testing.T) {
+	records := []Record{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	reader := StreamNDJSON(context.Background(), records)
+	defer reader.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("decode %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, record.ID)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(ids) != 3 || ids[0] != "a" || ids[2] != "c" {
+		t.Errorf("streamed %v, want a, b and c in order", ids)
+	}
+}
+
+func TestStreamNDJSONCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	reader := StreamNDJSON(ctx, []Record{{ID: "a"}})
+	defer reader.Close()
+	if _, err := io.ReadAll(reader); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadAll = %v, want the cancellation", err)
+	}
+}
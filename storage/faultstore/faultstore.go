@@ -0,0 +1,106 @@
+// Package faultstore wraps a storage backend and injects errors and delays,
+// for exercising the gateway's handling of a slow or failing store
+package faultstore
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"openailogger/storage"
+)
+
+// ErrInjected is returned by operations the store was told to fail
+var ErrInjected = errors.New("injected storage failure")
+
+// Store wraps another store. Save and Get wait for the configured latency and
+// then fail with ErrInjected at the configured rate, or for the next N calls
+// set with FailNext. Other operations pass straight through.
+type Store struct {
+	storage.Store
+
+	mu           sync.Mutex
+	rand         *rand.Rand
+	saveFailRate float64
+	getFailRate  float64
+	failNext     int
+	latency      time.Duration
+}
+
+// New wraps inner with no faults enabled
+func New(inner storage.Store) *Store {
+	return &Store{
+		Store: inner,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetFailureRate sets the share of Save and Get calls, between 0 and 1, that
+// fail
+func (s *Store) SetFailureRate(save, get float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveFailRate = save
+	s.getFailRate = get
+}
+
+// SetLatency delays every Save and Get by d
+func (s *Store) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// FailNext makes the next n Save or Get calls fail regardless of the rate
+func (s *Store) FailNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failNext = n
+}
+
+// Save stores the record unless a fault is injected
+func (s *Store) Save(ctx context.Context, r *storage.Record) error {
+	if err := s.inject(ctx, func() float64 { return s.saveFailRate }); err != nil {
+		return err
+	}
+	return s.Store.Save(ctx, r)
+}
+
+// Get retrieves the record unless a fault is injected
+func (s *Store) Get(ctx context.Context, id string) (*storage.Record, error) {
+	if err := s.inject(ctx, func() float64 { return s.getFailRate }); err != nil {
+		return nil, err
+	}
+	return s.Store.Get(ctx, id)
+}
+
+// inject waits for the latency and decides whether the call fails
+func (s *Store) inject(ctx context.Context, rate func() float64) error {
+	s.mu.Lock()
+	latency := s.latency
+	fail := false
+	if s.failNext > 0 {
+		s.failNext--
+		fail = true
+	} else if r := rate(); r > 0 {
+		fail = s.rand.Float64() < r
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if fail {
+		return ErrInjected
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"openailogger/storage"
+)
+
+// partitionLayout names daily partition files by UTC date
+const partitionLayout = "2006-01-02"
+
+// Store implements an append-only file storage backend. Records live in a
+// single log file, or in one log file per UTC day when partitioned so whole
+// days can be archived or dropped by removing a file.
+type Store struct {
+	mu       sync.RWMutex
+	dir      string // partition directory, empty when unpartitioned
+	segments map[string]*segment
+	owner    map[string]string // record ID to segment key
+	hub      storage.Hub
+}
+
+// New opens or creates a single log file at path and builds the offset index
+func New(path string) (*Store, error) {
+	seg, err := openSegment(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		segments: map[string]*segment{"": seg},
+		owner:    make(map[string]string),
+	}
+	for id := range seg.index {
+		s.owner[id] = ""
+	}
+	return s, nil
+}
+
+// NewPartitioned opens or creates a directory holding one log file per UTC
+// day, chosen by each record's timestamp
+func NewPartitioned(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create partition directory: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:      dir,
+		segments: make(map[string]*segment),
+		owner:    make(map[string]string),
+	}
+	for _, path := range paths {
+		key := strings.TrimSuffix(filepath.Base(path), ".log")
+		if _, err := time.Parse(partitionLayout, key); err != nil {
+			continue
+		}
+
+		seg, err := openSegment(path)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.segments[key] = seg
+		for id := range seg.index {
+			s.owner[id] = key
+		}
+	}
+
+	return s, nil
+}
+
+// Save appends a record to the log of its partition
+func (s *Store) Save(ctx context.Context, r *storage.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := s.partitionKey(r)
+	if current, exists := s.owner[r.ID]; exists && current != key {
+		return fmt.Errorf("record %s already stored in another partition", r.ID)
+	}
+
+	seg, err := s.segment(key)
+	if err != nil {
+		return err
+	}
+	if err := seg.put(r); err != nil {
+		return err
+	}
+
+	s.owner[r.ID] = key
+	s.hub.Publish(r)
+	return nil
+}
+
+// Watch streams records as they are saved until ctx is cancelled
+func (s *Store) Watch(ctx context.Context) (<-chan storage.Record, error) {
+	return s.hub.Subscribe(ctx), nil
+}
+
+// Get retrieves a record by ID
+func (s *Store) Get(ctx context.Context, id string) (*storage.Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, exists := s.owner[id]
+	if !exists {
+		return nil, fmt.Errorf("record not found: %s", id)
+	}
+
+	seg := s.segments[key]
+	return seg.read(seg.index[id])
+}
+
+// Update appends a new version of an existing record to its partition
+func (s *Store) Update(ctx context.Context, r *storage.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.owner[r.ID]
+	if !exists {
+		return fmt.Errorf("record not found: %s", r.ID)
+	}
+
+	seg := s.segments[key]
+	if err := seg.put(r); err != nil {
+		return err
+	}
+	return seg.maybeCompact()
+}
+
+// Modify applies change to the latest version of the record under the write
+// lock and appends it unless change returns false
+func (s *Store) Modify(ctx context.Context, id string, change func(*storage.Record) bool) (*storage.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.owner[id]
+	if !exists {
+		return nil, fmt.Errorf("record not found: %s", id)
+	}
+
+	seg := s.segments[key]
+	record, err := seg.read(seg.index[id])
+	if err != nil {
+		return nil, err
+	}
+	if !change(record) {
+		return record, nil
+	}
+	if err := seg.put(record); err != nil {
+		return nil, err
+	}
+	return record, seg.maybeCompact()
+}
+
+// List retrieves records matching the query, skipping partitions outside
+// the queried time range
+func (s *Store) List(ctx context.Context, q storage.Query) ([]storage.Record, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matches []*storage.Record
+
+	// Filter records
+	for key, seg := range s.segments {
+		if !s.partitionInRange(key, q.From, q.To) {
+			continue
+		}
+		for _, loc := range seg.index {
+			record, err := seg.read(loc)
+			if err != nil {
+				return nil, 0, err
+			}
+			if q.Matches(record) {
+				matches = append(matches, record)
+			}
+		}
+	}
+
+	// Sort records
+	storage.SortRecords(matches, q.Sort)
+
+	total := len(matches)
+	result := storage.Paginate(matches, q.Offset, q.Limit)
+
+	return result, total, nil
+}
+
+// ListSummary retrieves summaries of records matching the query
+func (s *Store) ListSummary(ctx context.Context, q storage.Query) ([]storage.RecordSummary, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matches []*storage.Record
+	for key, seg := range s.segments {
+		if !s.partitionInRange(key, q.From, q.To) {
+			continue
+		}
+		for _, loc := range seg.index {
+			record, err := seg.read(loc)
+			if err != nil {
+				return nil, 0, err
+			}
+			if q.Matches(record) {
+				matches = append(matches, record)
+			}
+		}
+	}
+
+	storage.SortRecords(matches, q.Sort)
+	return storage.PaginateSummaries(matches, q.Offset, q.Limit), len(matches), nil
+}
+
+// Delete appends a tombstone for a record
+func (s *Store) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.owner[id]
+	if !exists {
+		return fmt.Errorf("record not found: %s", id)
+	}
+
+	seg := s.segments[key]
+	if err := seg.remove(id); err != nil {
+		return err
+	}
+
+	delete(s.owner, id)
+	return seg.maybeCompact()
+}
+
+// ExportNDJSON streams the matching records as newline-delimited JSON
+func (s *Store) ExportNDJSON(ctx context.Context, q storage.Query) (io.ReadCloser, error) {
+	records, _, err := s.List(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return storage.StreamNDJSON(ctx, records), nil
+}
+
+// Flush syncs every log file to disk
+func (s *Store) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, seg := range s.segments {
+		if err := seg.sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compact rewrites every log keeping only the latest version of live
+// records and swaps each in atomically
+func (s *Store) Compact(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, seg := range s.segments {
+		if err := seg.compact(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropBefore removes whole daily partitions that end at or before t and
+// returns the number of records dropped. Partitions holding pinned records
+// are kept. Unpartitioned stores drop nothing.
+func (s *Store) DropBefore(ctx context.Context, t time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.segments))
+	for key := range s.segments {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	dropped := 0
+	for _, key := range keys {
+		day, err := time.Parse(partitionLayout, key)
+		if err != nil || day.Add(24*time.Hour).After(t) {
+			continue
+		}
+
+		seg := s.segments[key]
+		pinned, err := seg.hasPinned()
+		if err != nil {
+			return dropped, err
+		}
+		if pinned {
+			log.Printf("Keeping partition %s, it holds pinned records", key)
+			continue
+		}
+
+		if err := seg.close(); err != nil {
+			return dropped, err
+		}
+		if err := os.Remove(seg.path); err != nil {
+			return dropped, fmt.Errorf("failed to remove partition %s: %w", key, err)
+		}
+
+		for id := range seg.index {
+			delete(s.owner, id)
+		}
+		dropped += len(seg.index)
+		delete(s.segments, key)
+	}
+
+	return dropped, nil
+}
+
+// Close closes all log files
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for _, seg := range s.segments {
+		if err := seg.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// partitionKey returns the segment key a record belongs to
+func (s *Store) partitionKey(r *storage.Record) string {
+	if s.dir == "" {
+		return ""
+	}
+	return r.Timestamp.UTC().Format(partitionLayout)
+}
+
+// segment returns the segment for key, creating its file if needed. The
+// caller must hold the write lock.
+func (s *Store) segment(key string) (*segment, error) {
+	if seg, ok := s.segments[key]; ok {
+		return seg, nil
+	}
+
+	seg, err := openSegment(filepath.Join(s.dir, key+".log"))
+	if err != nil {
+		return nil, err
+	}
+	s.segments[key] = seg
+	return seg, nil
+}
+
+// partitionInRange reports whether a partition may hold records between
+// from and to
+func (s *Store) partitionInRange(key string, from, to *time.Time) bool {
+	day, err := time.Parse(partitionLayout, key)
+	if err != nil {
+		return true // Unpartitioned
+	}
+
+	if from != nil && !day.Add(24*time.Hour).After(*from) {
+		return false
+	}
+	if to != nil && day.After(*to) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"openailogger/storage"
+)
+
+func TestModifyIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	store, err := New(filepath.Join(t.TempDir(), "capture.log"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer store.Close()
+	if err := store.Save(ctx, &storage.Record{ID: "r1"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	const writers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Modify(ctx, "r1", func(record *storage.Record) bool {
+				record.Notes += "x"
+				return true
+			})
+		}()
+	}
+	wg.Wait()
+
+	record, err := store.Get(ctx, "r1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(record.Notes) != writers {
+		t.Errorf("got %d of %d edits, want none lost", len(record.Notes), writers)
+	}
+}
+
+func TestReopenAfterTornWrite(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "capture.log")
+
+	store, err := New(path)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := store.Save(ctx, &storage.Record{ID: "before", Provider: "openai"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	store.Close()
+
+	// A crash mid-append leaves a partial line at the end of the log
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op":"put","record":{"id":"torn","prov`)
+	file.Close()
+
+	store, err = New(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	if err := store.Save(ctx, &storage.Record{ID: "after", Provider: "openai"}); err != nil {
+		t.Fatalf("Save after reopen: %v", err)
+	}
+
+	for _, id := range []string{"before", "after"} {
+		if _, err := store.Get(ctx, id); err != nil {
+			t.Errorf("Get(%s): %v", id, err)
+		}
+	}
+	if _, err := store.Get(ctx, "torn"); err == nil {
+		t.Error("Get(torn) found the torn record")
+	}
+	records, total, err := store.List(ctx, storage.Query{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 2 || len(records) != 2 {
+		t.Errorf("List returned %d of %d records, want 2", len(records), total)
+	}
+}
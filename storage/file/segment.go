@@ -0,0 +1,263 @@
+package file
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"openailogger/storage"
+)
+
+const (
+	// compactMinBytes is the log size below which automatic compaction is skipped
+	compactMinBytes = 8 * 1024 * 1024
+	// compactDeadRatio triggers automatic compaction once this share of the
+	// log is taken up by deleted or superseded entries
+	compactDeadRatio = 0.5
+)
+
+// entry is one line of the append-only log
+type entry struct {
+	Op     string          `json:"op"` // "put" or "del"
+	ID     string          `json:"id,omitempty"`
+	Record *storage.Record `json:"record,omitempty"`
+}
+
+// location points at the latest put entry for a record
+type location struct {
+	offset int64
+	length int64
+}
+
+// segment is a single append-only log file with an in-memory index pointing
+// at the latest version of each record. Callers synchronize access.
+type segment struct {
+	path      string
+	file      *os.File
+	size      int64
+	liveBytes int64
+	index     map[string]location
+}
+
+// openSegment opens or creates a log file and builds its index
+func openSegment(path string) (*segment, error) {
+	seg := &segment{path: path}
+	if err := seg.open(); err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
+
+// open opens the log file and rebuilds the index from its contents
+func (sg *segment) open() error {
+	file, err := os.OpenFile(sg.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open store file: %w", err)
+	}
+
+	index, size, liveBytes, err := buildIndex(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	// Drop a torn line left by an interrupted write, appends would otherwise
+	// land after it and every later offset would be off
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to truncate store file: %w", err)
+	}
+
+	sg.file = file
+	sg.index = index
+	sg.size = size
+	sg.liveBytes = liveBytes
+	return nil
+}
+
+// buildIndex scans the log and returns the latest location of every live record
+func buildIndex(file *os.File) (map[string]location, int64, int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to read store file: %w", err)
+	}
+
+	index := make(map[string]location)
+	var offset, liveBytes int64
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var e entry
+			if jsonErr := json.Unmarshal(line, &e); jsonErr == nil {
+				switch {
+				case e.Op == "put" && e.Record != nil:
+					if old, ok := index[e.Record.ID]; ok {
+						liveBytes -= old.length
+					}
+					index[e.Record.ID] = location{offset: offset, length: int64(len(line))}
+					liveBytes += int64(len(line))
+				case e.Op == "del":
+					if old, ok := index[e.ID]; ok {
+						liveBytes -= old.length
+						delete(index, e.ID)
+					}
+				}
+			}
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			// A trailing partial line is left over from an interrupted write
+			break
+		}
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to read store file: %w", err)
+		}
+	}
+
+	return index, offset, liveBytes, nil
+}
+
+// put appends a record version and points the index at it
+func (sg *segment) put(r *storage.Record) error {
+	loc, err := sg.append(entry{Op: "put", Record: r})
+	if err != nil {
+		return err
+	}
+
+	if old, ok := sg.index[r.ID]; ok {
+		sg.liveBytes -= old.length
+	}
+	sg.index[r.ID] = loc
+	sg.liveBytes += loc.length
+	return nil
+}
+
+// remove appends a tombstone and drops the record from the index
+func (sg *segment) remove(id string) error {
+	if _, err := sg.append(entry{Op: "del", ID: id}); err != nil {
+		return err
+	}
+
+	sg.liveBytes -= sg.index[id].length
+	delete(sg.index, id)
+	return nil
+}
+
+// append writes an entry at the end of the log
+func (sg *segment) append(e entry) (location, error) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return location{}, fmt.Errorf("failed to encode record: %w", err)
+	}
+	line = append(line, '\n')
+
+	if _, err := sg.file.Write(line); err != nil {
+		// Keep a short write from shifting later entries
+		sg.file.Truncate(sg.size)
+		return location{}, fmt.Errorf("failed to write store file: %w", err)
+	}
+
+	loc := location{offset: sg.size, length: int64(len(line))}
+	sg.size += loc.length
+	return loc, nil
+}
+
+// read decodes the record stored at loc
+func (sg *segment) read(loc location) (*storage.Record, error) {
+	line := make([]byte, loc.length)
+	if _, err := sg.file.ReadAt(line, loc.offset); err != nil {
+		return nil, fmt.Errorf("failed to read store file: %w", err)
+	}
+
+	var e entry
+	if err := json.Unmarshal(line, &e); err != nil || e.Record == nil {
+		return nil, fmt.Errorf("corrupt entry at offset %d", loc.offset)
+	}
+	return e.Record, nil
+}
+
+// hasPinned reports whether any live record in the segment is pinned
+func (sg *segment) hasPinned() (bool, error) {
+	for _, loc := range sg.index {
+		record, err := sg.read(loc)
+		if err != nil {
+			return false, err
+		}
+		if record.Pinned {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// maybeCompact compacts the log once dead entries dominate it
+func (sg *segment) maybeCompact() error {
+	if sg.size < compactMinBytes {
+		return nil
+	}
+	if float64(sg.size-sg.liveBytes)/float64(sg.size) < compactDeadRatio {
+		return nil
+	}
+	return sg.compact()
+}
+
+// compact writes live records to a temporary file, syncs it and renames it
+// over the log
+func (sg *segment) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(sg.path), filepath.Base(sg.path)+".compact-*")
+	if err != nil {
+		return fmt.Errorf("failed to create compaction file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	writer := bufio.NewWriter(tmp)
+	for _, loc := range sg.index {
+		line := make([]byte, loc.length)
+		if _, err := sg.file.ReadAt(line, loc.offset); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to read store file: %w", err)
+		}
+		if _, err := writer.Write(line); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write compaction file: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write compaction file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync compaction file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close compaction file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), sg.path); err != nil {
+		return fmt.Errorf("failed to replace store file: %w", err)
+	}
+
+	old := sg.file
+	if err := sg.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+// sync commits the log file to disk
+func (sg *segment) sync() error {
+	if err := sg.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync store file: %w", err)
+	}
+	return nil
+}
+
+// close closes the log file
+func (sg *segment) close() error {
+	return sg.file.Close()
+}
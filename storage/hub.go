@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+// watchBuffer is the number of records a slow watcher may lag behind before
+// records are dropped for it
+const watchBuffer = 64
+
+// Hub fans out newly saved records to watchers. The zero value is ready to
+// use. Publishing never blocks, slow watchers miss records instead.
+type Hub struct {
+	mu       sync.Mutex
+	watchers map[chan Record]struct{}
+}
+
+// Subscribe returns a channel receiving published records until ctx is
+// cancelled, after which it is closed
+func (h *Hub) Subscribe(ctx context.Context) <-chan Record {
+	ch := make(chan Record, watchBuffer)
+
+	h.mu.Lock()
+	if h.watchers == nil {
+		h.watchers = make(map[chan Record]struct{})
+	}
+	h.watchers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.mu.Lock()
+		delete(h.watchers, ch)
+		h.mu.Unlock()
+		close(ch)
+	}()
+
+	return ch
+}
+
+// Publish sends a copy of the record to every watcher
+func (h *Hub) Publish(r *Record) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.watchers {
+		select {
+		case ch <- *r:
+		default:
+		}
+	}
+}
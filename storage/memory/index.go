@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"openailogger/storage"
+)
+
+// indexEntry locates a record in a provider index
+type indexEntry struct {
+	ts time.Time
+	id string
+}
+
+// providerIndex keeps the records of each provider sorted by timestamp so
+// provider and time range queries don't scan the whole store
+type providerIndex map[string][]indexEntry
+
+// add inserts a record at its timestamp position
+func (idx providerIndex) add(r *storage.Record) {
+	entries := idx[r.Provider]
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].ts.After(r.Timestamp) })
+	entries = append(entries, indexEntry{})
+	copy(entries[i+1:], entries[i:])
+	entries[i] = indexEntry{ts: r.Timestamp, id: r.ID}
+	idx[r.Provider] = entries
+}
+
+// remove drops a record from the index
+func (idx providerIndex) remove(r *storage.Record) {
+	entries := idx[r.Provider]
+	i := sort.Search(len(entries), func(i int) bool { return !entries[i].ts.Before(r.Timestamp) })
+	for ; i < len(entries) && entries[i].ts.Equal(r.Timestamp); i++ {
+		if entries[i].id == r.ID {
+			idx[r.Provider] = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(idx[r.Provider]) == 0 {
+		delete(idx, r.Provider)
+	}
+}
+
+// lookup returns the IDs of the provider's records within the optional
+// time range
+func (idx providerIndex) lookup(provider string, from, to *time.Time) []string {
+	entries := idx[provider]
+	start, end := 0, len(entries)
+	if from != nil {
+		start = sort.Search(len(entries), func(i int) bool { return !entries[i].ts.Before(*from) })
+	}
+	if to != nil {
+		end = sort.Search(len(entries), func(i int) bool { return entries[i].ts.After(*to) })
+	}
+
+	var ids []string
+	for i := start; i < end; i++ {
+		ids = append(ids, entries[i].id)
+	}
+	return ids
+}
@@ -1,13 +1,10 @@
 package memory
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
-	"sort"
-	"strings"
+	"slices"
 	"sync"
 
 	"openailogger/storage"
@@ -15,8 +12,23 @@ import (
 
 // Store implements an in-memory storage backend
 type Store struct {
-	mu      sync.RWMutex
-	records map[string]*storage.Record
+	mu       sync.RWMutex
+	records  map[string]*storage.Record
+	hub      storage.Hub
+	maxBytes int64         // 0 means unbounded
+	bytes    int64         // approximate body bytes held
+	order    []string      // IDs in save order, may hold deleted IDs until compacted
+	index    providerIndex // nil unless enabled
+}
+
+// Options configures an in-memory store
+type Options struct {
+	// MaxBytes evicts the oldest unpinned records once the bodies held
+	// exceed it, 0 means unbounded
+	MaxBytes int64
+	// ProviderIndex keeps each provider's records sorted by time so provider
+	// queries avoid a full scan, at the cost of extra memory per record
+	ProviderIndex bool
 }
 
 // New creates a new in-memory store
@@ -26,6 +38,22 @@ func New() *Store {
 	}
 }
 
+// NewWithMaxBytes creates an in-memory store that evicts the oldest unpinned
+// records once the bodies it holds exceed maxBytes
+func NewWithMaxBytes(maxBytes int64) *Store {
+	return NewWithOptions(Options{MaxBytes: maxBytes})
+}
+
+// NewWithOptions creates an in-memory store with the given options
+func NewWithOptions(opts Options) *Store {
+	s := New()
+	s.maxBytes = opts.MaxBytes
+	if opts.ProviderIndex {
+		s.index = make(providerIndex)
+	}
+	return s
+}
+
 // Save stores a record in memory
 func (s *Store) Save(ctx context.Context, r *storage.Record) error {
 	s.mu.Lock()
@@ -33,10 +61,28 @@ func (s *Store) Save(ctx context.Context, r *storage.Record) error {
 
 	// Create a copy to avoid external modifications
 	record := *r
+	if old, exists := s.records[r.ID]; exists {
+		s.bytes -= recordBytes(old)
+		s.unindex(old)
+	} else if s.maxBytes > 0 {
+		s.order = append(s.order, r.ID)
+	}
 	s.records[r.ID] = &record
+	s.bytes += recordBytes(&record)
+	if s.index != nil {
+		s.index.add(&record)
+	}
+	s.evict()
+
+	s.hub.Publish(&record)
 	return nil
 }
 
+// Watch streams records as they are saved until ctx is cancelled
+func (s *Store) Watch(ctx context.Context) (<-chan storage.Record, error) {
+	return s.hub.Subscribe(ctx), nil
+}
+
 // Get retrieves a record by ID
 func (s *Store) Get(ctx context.Context, id string) (*storage.Record, error) {
 	s.mu.RLock()
@@ -52,42 +98,77 @@ func (s *Store) Get(ctx context.Context, id string) (*storage.Record, error) {
 	return &result, nil
 }
 
+// Update replaces an existing record
+func (s *Store) Update(ctx context.Context, r *storage.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.records[r.ID]; !exists {
+		return fmt.Errorf("record not found: %s", r.ID)
+	}
+
+	record := *r
+	s.replace(&record)
+	return nil
+}
+
+// Modify applies change to a copy of the record under the write lock and
+// stores it unless change returns false
+func (s *Store) Modify(ctx context.Context, id string, change func(*storage.Record) bool) (*storage.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.records[id]
+	if !exists {
+		return nil, fmt.Errorf("record not found: %s", id)
+	}
+
+	record := *current
+	if change(&record) {
+		stored := record
+		s.replace(&stored)
+	}
+	return &record, nil
+}
+
+// replace swaps in a new version of an existing record. The caller must
+// hold the write lock.
+func (s *Store) replace(record *storage.Record) {
+	old := s.records[record.ID]
+	s.bytes += recordBytes(record) - recordBytes(old)
+	s.unindex(old)
+	s.records[record.ID] = record
+	if s.index != nil {
+		s.index.add(record)
+	}
+}
+
 // List retrieves records matching the query
 func (s *Store) List(ctx context.Context, q storage.Query) ([]storage.Record, int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var matches []*storage.Record
-
 	// Filter records
-	for _, record := range s.records {
-		if s.matchesQuery(record, q) {
-			matches = append(matches, record)
-		}
-	}
+	matches := s.matching(q)
 
 	// Sort records
-	s.sortRecords(matches, q.Sort)
+	storage.SortRecords(matches, q.Sort)
 
 	total := len(matches)
+	result := storage.Paginate(matches, q.Offset, q.Limit)
 
-	// Apply pagination
-	start := q.Offset
-	if start > len(matches) {
-		start = len(matches)
-	}
-
-	end := start + q.Limit
-	if q.Limit <= 0 || end > len(matches) {
-		end = len(matches)
-	}
+	return result, total, nil
+}
 
-	result := make([]storage.Record, end-start)
-	for i, record := range matches[start:end] {
-		result[i] = *record // Copy to avoid external modifications
-	}
+// ListSummary retrieves summaries of records matching the query without
+// copying their bodies
+func (s *Store) ListSummary(ctx context.Context, q storage.Query) ([]storage.RecordSummary, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return result, total, nil
+	matches := s.matching(q)
+	storage.SortRecords(matches, q.Sort)
+	return storage.PaginateSummaries(matches, q.Offset, q.Limit), len(matches), nil
 }
 
 // Delete removes a record by ID
@@ -95,87 +176,133 @@ func (s *Store) Delete(ctx context.Context, id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.records[id]; !exists {
+	record, exists := s.records[id]
+	if !exists {
 		return fmt.Errorf("record not found: %s", id)
 	}
 
+	s.bytes -= recordBytes(record)
+	s.unindex(record)
 	delete(s.records, id)
+	s.compact()
 	return nil
 }
 
-// ExportNDJSON exports records as newline-delimited JSON
-func (s *Store) ExportNDJSON(ctx context.Context, q storage.Query) (io.ReadCloser, error) {
-	records, _, err := s.List(ctx, q)
-	if err != nil {
-		return nil, err
+// matching returns the records matching q. Provider queries are answered
+// from the provider index when enabled. The caller must hold the lock.
+func (s *Store) matching(q storage.Query) []*storage.Record {
+	var matches []*storage.Record
+	if s.index != nil && len(q.Providers) > 0 {
+		seen := make(map[string]bool)
+		for _, provider := range q.Providers {
+			if seen[provider] {
+				continue
+			}
+			seen[provider] = true
+			for _, id := range s.index.lookup(provider, q.From, q.To) {
+				if record := s.records[id]; q.Matches(record) {
+					matches = append(matches, record)
+				}
+			}
+		}
+		return matches
 	}
 
-	var buf bytes.Buffer
-	encoder := json.NewEncoder(&buf)
-
-	for _, record := range records {
-		if err := encoder.Encode(record); err != nil {
-			return nil, fmt.Errorf("failed to encode record: %w", err)
+	for _, record := range s.records {
+		if q.Matches(record) {
+			matches = append(matches, record)
 		}
 	}
-
-	return io.NopCloser(&buf), nil
+	return matches
 }
 
-// Close closes the store (no-op for memory store)
-func (s *Store) Close() error {
-	return nil
+// unindex removes a record from the provider index when enabled. The
+// caller must hold the write lock.
+func (s *Store) unindex(record *storage.Record) {
+	if s.index != nil {
+		s.index.remove(record)
+	}
 }
 
-// matchesQuery checks if a record matches the query filters
-func (s *Store) matchesQuery(record *storage.Record, q storage.Query) bool {
-	if q.Provider != nil && record.Provider != *q.Provider {
-		return false
+// evict drops the oldest unpinned records until the held bytes fit under
+// maxBytes. The caller must hold the write lock.
+func (s *Store) evict() {
+	if s.maxBytes <= 0 {
+		return
 	}
 
-	if q.StatusEq != nil && record.Status != *q.StatusEq {
-		return false
-	}
+	var pinned []string
+	for s.bytes > s.maxBytes && len(s.order) > 0 {
+		id := s.order[0]
+		s.order = s.order[1:]
 
-	if q.From != nil && record.Timestamp.Before(*q.From) {
-		return false
-	}
+		record, exists := s.records[id]
+		if !exists {
+			continue // Deleted earlier
+		}
+		if record.Pinned {
+			pinned = append(pinned, id)
+			continue
+		}
 
-	if q.To != nil && record.Timestamp.After(*q.To) {
-		return false
+		s.bytes -= recordBytes(record)
+		s.unindex(record)
+		delete(s.records, id)
 	}
 
-	if q.ModelLike != nil && !strings.Contains(strings.ToLower(record.ModelHint), strings.ToLower(*q.ModelLike)) {
-		return false
-	}
+	// Pinned records keep their place at the front of the queue
+	s.order = append(pinned, s.order...)
+}
 
-	if q.URLLike != nil && !strings.Contains(strings.ToLower(record.URL), strings.ToLower(*q.URLLike)) {
-		return false
+// compactSlack is how many deleted IDs the eviction queue may hold beyond the
+// live ones before it is compacted
+const compactSlack = 1024
+
+// compact drops the IDs of deleted records from the eviction queue once they
+// outnumber the live ones, so delete churn can't grow it without bound. An ID
+// saved again after its deletion keeps its latest place. The caller must hold
+// the write lock.
+func (s *Store) compact() {
+	if len(s.order) <= 2*len(s.records)+compactSlack {
+		return
 	}
 
-	if q.TextSearch != nil {
-		searchTerm := strings.ToLower(*q.TextSearch)
-		searchableText := strings.ToLower(record.RequestBody + " " + record.ResponseBody + " " + record.URL + " " + record.ModelHint)
-		if !strings.Contains(searchableText, searchTerm) {
-			return false
+	seen := make(map[string]bool, len(s.records))
+	live := make([]string, 0, len(s.records))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		id := s.order[i]
+		if _, exists := s.records[id]; !exists || seen[id] {
+			continue
 		}
+		seen[id] = true
+		live = append(live, id)
 	}
+	slices.Reverse(live)
+	s.order = live
+}
 
-	return true
+// recordBytes approximates the memory a record holds by its body sizes
+func recordBytes(r *storage.Record) int64 {
+	n := int64(len(r.RequestBody) + len(r.ResponseBody) + len(r.RewrittenResponse))
+	for _, chunk := range r.ResponseChunks {
+		n += int64(len(chunk))
+	}
+	for _, message := range r.WSMessages {
+		n += int64(len(message.Data))
+	}
+	return n
 }
 
-// sortRecords sorts records based on the sort parameter
-func (s *Store) sortRecords(records []*storage.Record, sortBy string) {
-	switch sortBy {
-	case "-ts":
-		sort.Slice(records, func(i, j int) bool {
-			return records[i].Timestamp.After(records[j].Timestamp)
-		})
-	case "ts":
-		fallthrough
-	default:
-		sort.Slice(records, func(i, j int) bool {
-			return records[i].Timestamp.Before(records[j].Timestamp)
-		})
+// ExportNDJSON streams the matching records as newline-delimited JSON
+func (s *Store) ExportNDJSON(ctx context.Context, q storage.Query) (io.ReadCloser, error) {
+	records, _, err := s.List(ctx, q)
+	if err != nil {
+		return nil, err
 	}
+	return storage.StreamNDJSON(ctx, records), nil
+}
+
+// Close closes the store (no-op for memory store)
+func (s *Store) Close() error {
+	return nil
 }
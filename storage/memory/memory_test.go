@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"openailogger/storage"
+)
+
+func TestModifyIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	store := New()
+	if err := store.Save(ctx, &storage.Record{ID: "r1"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	const writers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Modify(ctx, "r1", func(record *storage.Record) bool {
+				record.Notes += "x"
+				return true
+			})
+		}()
+	}
+	wg.Wait()
+
+	record, err := store.Get(ctx, "r1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(record.Notes) != writers {
+		t.Errorf("got %d of %d edits, want none lost", len(record.Notes), writers)
+	}
+}
+
+func TestDeleteCompactsEvictionQueue(t *testing.T) {
+	ctx := context.Background()
+	store := NewWithMaxBytes(1 << 20)
+
+	const churn = 10 * compactSlack
+	for i := 0; i < churn; i++ {
+		id := fmt.Sprintf("r%d", i)
+		store.Save(ctx, &storage.Record{ID: id, RequestBody: "{}"})
+		if err := store.Delete(ctx, id); err != nil {
+			t.Fatalf("Delete(%s): %v", id, err)
+		}
+	}
+	store.Save(ctx, &storage.Record{ID: "kept", RequestBody: "{}"})
+
+	if n := len(store.order); n > compactSlack+2 {
+		t.Errorf("eviction queue holds %d IDs after %d deletes, want it compacted", n, churn)
+	}
+	if _, err := store.Get(ctx, "kept"); err != nil {
+		t.Errorf("Get(kept): %v", err)
+	}
+}
+
+// BenchmarkList compares the "recent records of one provider" query with
+// and without the provider index
+func BenchmarkList(b *testing.B) {
+	const records, providers = 20000, 20
+
+	for _, indexed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("index=%v", indexed), func(b *testing.B) {
+			ctx := context.Background()
+			store := NewWithOptions(Options{ProviderIndex: indexed})
+			start := time.Now().Add(-records * time.Second)
+			for i := 0; i < records; i++ {
+				store.Save(ctx, &storage.Record{
+					ID:        fmt.Sprintf("r%d", i),
+					Timestamp: start.Add(time.Duration(i) * time.Second),
+					Provider:  fmt.Sprintf("provider%d", i%providers),
+				})
+			}
+
+			from := start.Add(records * time.Second / 2)
+			query := storage.Query{Providers: []string{"provider3"}, From: &from, Sort: "-ts", Limit: 50}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := store.List(ctx, query); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
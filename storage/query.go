@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Matches checks if a record matches the query filters
+func (q Query) Matches(record *Record) bool {
+	if len(q.Providers) > 0 && !slices.Contains(q.Providers, record.Provider) {
+		return false
+	}
+
+	if len(q.CanonicalProviders) > 0 && !slices.Contains(q.CanonicalProviders, record.CanonicalProvider) {
+		return false
+	}
+
+	if q.Tenant != nil && record.TenantID != *q.Tenant {
+		return false
+	}
+
+	if q.Pinned != nil && record.Pinned != *q.Pinned {
+		return false
+	}
+
+	if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, record.Status) {
+		return false
+	}
+
+	if len(q.ErrorTypes) > 0 && !slices.Contains(q.ErrorTypes, record.ErrorType) {
+		return false
+	}
+
+	for key, values := range q.Metadata {
+		if value, ok := record.Metadata[key]; !ok || !slices.Contains(values, value) {
+			return false
+		}
+	}
+
+	if q.Batch != nil && record.BatchID != *q.Batch && record.BatchFileID != *q.Batch {
+		return false
+	}
+
+	if len(q.Kinds) > 0 && !slices.Contains(q.Kinds, record.Kind) {
+		return false
+	}
+
+	if q.ExpiresBefore != nil && (record.ExpiresAt == nil || !record.ExpiresAt.Before(*q.ExpiresBefore)) {
+		return false
+	}
+
+	if q.From != nil && record.Timestamp.Before(*q.From) {
+		return false
+	}
+
+	if q.To != nil && record.Timestamp.After(*q.To) {
+		return false
+	}
+
+	if len(q.ModelLike) > 0 && !containsAny(record.ModelHint, q.ModelLike) {
+		return false
+	}
+
+	if q.URLLike != nil && !strings.Contains(strings.ToLower(record.URL), strings.ToLower(*q.URLLike)) {
+		return false
+	}
+
+	if q.RequestHash != nil && record.RequestHash != *q.RequestHash {
+		return false
+	}
+
+	if q.ReplayOf != nil && record.ReplayOf != *q.ReplayOf {
+		return false
+	}
+
+	if q.MinTokens != nil || q.MaxTokens != nil {
+		if record.Usage == nil {
+			return false
+		}
+		if q.MinTokens != nil && record.Usage.TotalTokens < *q.MinTokens {
+			return false
+		}
+		if q.MaxTokens != nil && record.Usage.TotalTokens > *q.MaxTokens {
+			return false
+		}
+	}
+
+	if q.MultiChoice != nil && (record.ChoiceCount > 1) != *q.MultiChoice {
+		return false
+	}
+
+	if q.ContentFiltered != nil && record.ContentFiltered != *q.ContentFiltered {
+		return false
+	}
+
+	if q.CacheHit != nil && record.CacheHit != *q.CacheHit {
+		return false
+	}
+
+	if q.TextSearch != nil {
+		searchTerm := strings.ToLower(*q.TextSearch)
+		searchableText := strings.ToLower(record.RequestBody + " " + record.ResponseBody + " " + record.URL + " " + record.ModelHint + " " + record.Title + " " + record.Notes)
+		if !strings.Contains(searchableText, searchTerm) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsAny reports whether s contains any of the terms, case-insensitively
+func containsAny(s string, terms []string) bool {
+	s = strings.ToLower(s)
+	for _, term := range terms {
+		if strings.Contains(s, strings.ToLower(term)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortFields compares records in ascending order of each sortable field
+var sortFields = map[string]func(a, b *Record) bool{
+	"ts":                  func(a, b *Record) bool { return a.Timestamp.Before(b.Timestamp) },
+	"duration_ms":         func(a, b *Record) bool { return a.DurationMS < b.DurationMS },
+	"gateway_overhead_ms": func(a, b *Record) bool { return a.GatewayOverheadMS < b.GatewayOverheadMS },
+	"content_chars":       func(a, b *Record) bool { return a.ContentChars < b.ContentChars },
+	"title":               func(a, b *Record) bool { return a.Title < b.Title },
+}
+
+// IsSortable reports whether records can be sorted by sortBy, a sortable
+// field optionally prefixed with "-" for descending order
+func IsSortable(sortBy string) bool {
+	_, ok := sortFields[strings.TrimPrefix(sortBy, "-")]
+	return ok
+}
+
+// SortRecords sorts records by a sortable field, "-" prefixed for
+// descending order, falling back to ascending timestamps
+func SortRecords(records []*Record, sortBy string) {
+	field, descending := strings.CutPrefix(sortBy, "-")
+	less, ok := sortFields[field]
+	if !ok {
+		less, descending = sortFields["ts"], false
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if descending {
+			return less(records[j], records[i])
+		}
+		return less(records[i], records[j])
+	})
+}
+
+// Paginate copies the requested page of records
+func Paginate(records []*Record, offset, limit int) []Record {
+	start, end := pageBounds(len(records), offset, limit)
+
+	result := make([]Record, end-start)
+	for i, record := range records[start:end] {
+		result[i] = *record // Copy to avoid external modifications
+	}
+	return result
+}
+
+// PaginateSummaries returns summaries of the requested page of records
+func PaginateSummaries(records []*Record, offset, limit int) []RecordSummary {
+	start, end := pageBounds(len(records), offset, limit)
+
+	result := make([]RecordSummary, end-start)
+	for i, record := range records[start:end] {
+		result[i] = record.Summary()
+	}
+	return result
+}
+
+// pageBounds returns the slice bounds of a page within n records
+func pageBounds(n, offset, limit int) (int, int) {
+	start := offset
+	if start > n {
+		start = n
+	}
+
+	end := start + limit
+	if limit <= 0 || end > n {
+		end = n
+	}
+	return start, end
+}
@@ -2,50 +2,222 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"time"
 )
 
 // Record represents a captured request/response pair
 type Record struct {
-	ID             string    `json:"id"`
-	Timestamp      time.Time `json:"ts"`
-	Provider       string    `json:"provider"`
-	Method         string    `json:"method"`
-	URL            string    `json:"url"`
-	Upstream       string    `json:"upstream"`
-	Status         int       `json:"status"`
-	DurationMS     int64     `json:"duration_ms"`
-	RequestBody    string    `json:"request_body"`
-	ResponseBody   string    `json:"response_body"`
-	Stream         bool      `json:"stream"`
-	ResponseChunks []string  `json:"response_chunks,omitempty"`
-	SizeReqBytes   int64     `json:"size_req_bytes"`
-	SizeResBytes   int64     `json:"size_res_bytes"`
-	ModelHint      string    `json:"model_hint,omitempty"`
-	Error          *string   `json:"error,omitempty"`
+	ID                       string              `json:"id"`
+	Timestamp                time.Time           `json:"ts"`
+	Provider                 string              `json:"provider"`
+	Title                    string              `json:"title,omitempty"`
+	CanonicalProvider        string              `json:"canonical_provider,omitempty"`
+	TenantID                 string              `json:"tenant_id,omitempty"`
+	Method                   string              `json:"method"`
+	URL                      string              `json:"url"`
+	RequestLine              string              `json:"request_line,omitempty"`
+	Upstream                 string              `json:"upstream"`
+	UpstreamName             string              `json:"upstream_name,omitempty"`
+	Status                   int                 `json:"status"`
+	StatusLine               string              `json:"status_line,omitempty"`
+	GRPCMethod               string              `json:"grpc_method,omitempty"`
+	GRPCStatus               *int                `json:"grpc_status,omitempty"`
+	GRPCMessage              string              `json:"grpc_message,omitempty"`
+	Attempts                 int                 `json:"attempts,omitempty"`
+	Incomplete               bool                `json:"incomplete,omitempty"`
+	DurationMS               int64               `json:"duration_ms"`
+	UpstreamLatencyMS        int64               `json:"upstream_latency_ms"`
+	GatewayOverheadMS        int64               `json:"gateway_overhead_ms"`
+	StorageQueueMS           int64               `json:"storage_queue_ms"`
+	RequestBody              string              `json:"request_body"`
+	RequestPreview           string              `json:"request_preview,omitempty"`
+	RequestForm              map[string][]string `json:"request_form,omitempty"`
+	RequestCharset           string              `json:"request_charset,omitempty"`
+	ResponseBody             string              `json:"response_body"`
+	ResponsePreview          string              `json:"response_preview,omitempty"`
+	RewrittenResponse        string              `json:"rewritten_response_body,omitempty"`
+	ResponseCharset          string              `json:"response_charset,omitempty"`
+	ResponseEncoding         string              `json:"response_encoding,omitempty"`
+	BodyEncoding             string              `json:"body_encoding,omitempty"`
+	RequestHeaders           map[string][]string `json:"request_headers,omitempty"`
+	ResponseHeaders          map[string][]string `json:"response_headers,omitempty"`
+	Stream                   bool                `json:"stream"`
+	CacheHit                 bool                `json:"cache_hit,omitempty"`
+	ResponseChunks           []string            `json:"response_chunks,omitempty"`
+	WSMessages               []WSMessage         `json:"ws_messages,omitempty"`
+	ReconstructedResponse    string              `json:"reconstructed_response,omitempty"`
+	ReconstructionPartial    bool                `json:"reconstruction_partial,omitempty"`
+	EventTypeCounts          map[string]int      `json:"event_type_counts,omitempty"`
+	SizeReqBytes             int64               `json:"size_req_bytes"`
+	RequestTruncated         bool                `json:"request_truncated,omitempty"`
+	RequestHash              string              `json:"request_hash,omitempty"`
+	SizeResBytes             int64               `json:"size_res_bytes"`
+	ResponseTruncated        bool                `json:"response_truncated,omitempty"`
+	SizeResDecompressedBytes int64               `json:"size_res_decompressed_bytes,omitempty"`
+	ModelHint                string              `json:"model_hint,omitempty"`
+	EffectiveModel           string              `json:"effective_model,omitempty"`
+	BatchID                  string              `json:"batch_id,omitempty"`
+	BatchFileID              string              `json:"batch_file_id,omitempty"`
+	BatchLines               int                 `json:"batch_lines,omitempty"`
+	Kind                     string              `json:"kind,omitempty"`
+	ChoiceCount              int                 `json:"choice_count,omitempty"`
+	FinishReasons            []string            `json:"finish_reasons,omitempty"`
+	ToolCallCount            int                 `json:"tool_call_count,omitempty"`
+	ContentChars             int                 `json:"content_chars,omitempty"`
+	ContentFiltered          bool                `json:"content_filtered,omitempty"`
+	FilterCategories         []string            `json:"filter_categories,omitempty"`
+	Redactions               map[string]int      `json:"redactions,omitempty"`
+	Usage                    *Usage              `json:"usage,omitempty"`
+	Notes                    string              `json:"notes,omitempty"`
+	Metadata                 map[string]string   `json:"metadata,omitempty"`
+	Pinned                   bool                `json:"pinned,omitempty"`
+	ExpiresAt                *time.Time          `json:"expires_at,omitempty"`
+	ReplayOf                 string              `json:"replay_of,omitempty"`
+	ReplayOverrides          json.RawMessage     `json:"replay_overrides,omitempty"`
+	Error                    *string             `json:"error,omitempty"`
+	ErrorType                string              `json:"error_type,omitempty"`
+	EnqueuedAt               time.Time           `json:"-"`
+}
+
+// RecordSummary is the light view of a record used by list views
+type RecordSummary struct {
+	ID         string    `json:"id"`
+	Timestamp  time.Time `json:"ts"`
+	Provider   string    `json:"provider"`
+	ModelHint  string    `json:"model_hint,omitempty"`
+	Title      string    `json:"title,omitempty"`
+	Status     int       `json:"status"`
+	DurationMS int64     `json:"duration_ms"`
+	// Previews are short snippets of the bodies
+	RequestPreview  string `json:"request_preview,omitempty"`
+	ResponsePreview string `json:"response_preview,omitempty"`
+}
+
+// Summary returns the light view of the record
+func (r *Record) Summary() RecordSummary {
+	return RecordSummary{
+		ID:              r.ID,
+		Timestamp:       r.Timestamp,
+		Provider:        r.Provider,
+		ModelHint:       r.ModelHint,
+		Title:           r.Title,
+		Status:          r.Status,
+		DurationMS:      r.DurationMS,
+		RequestPreview:  r.RequestPreview,
+		ResponsePreview: r.ResponsePreview,
+	}
+}
+
+// WSMessage is one websocket message exchanged on an upgraded connection.
+// Text is stored as is, other payloads base64-encoded.
+type WSMessage struct {
+	Direction string    `json:"direction"` // "client" or "server"
+	Timestamp time.Time `json:"ts"`
+	Type      string    `json:"type"` // "text", "binary", "close", "ping" or "pong"
+	Data      string    `json:"data,omitempty"`
+	Size      int64     `json:"size"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// Usage holds the token counts reported by the provider in the response
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 // Query represents search/filter parameters for records
+// Repeated values within a field match any of them, fields are combined with AND.
 type Query struct {
-	Provider   *string
-	ModelLike  *string
-	URLLike    *string
-	StatusEq   *int
-	From       *time.Time
-	To         *time.Time
-	TextSearch *string
-	Offset     int
-	Limit      int
-	Sort       string // "ts" or "-ts"
+	Providers          []string
+	CanonicalProviders []string
+	ModelLike          []string
+	URLLike            *string
+	RequestHash        *string
+	ReplayOf           *string
+	Tenant             *string
+	Pinned             *bool
+	Statuses           []int
+	ErrorTypes         []string
+	Kinds              []string
+	Batch              *string             // batch ID or batch file ID
+	Metadata           map[string][]string // key to values, any value matches
+	From               *time.Time
+	To                 *time.Time
+	ExpiresBefore      *time.Time // records with an ExpiresAt before this
+	TextSearch         *string
+	MinTokens          *int // total tokens, records without usage never match
+	MaxTokens          *int
+	MultiChoice        *bool // ChoiceCount > 1
+	ContentFiltered    *bool
+	CacheHit           *bool
+	Offset             int
+	Limit              int
+	Sort               string // "ts", "duration_ms", "gateway_overhead_ms", "content_chars" or "title", "-" prefixed for descending
 }
 
 // Store defines the interface for storage backends
 type Store interface {
 	Save(ctx context.Context, r *Record) error
 	Get(ctx context.Context, id string) (*Record, error)
+	Update(ctx context.Context, r *Record) error
 	List(ctx context.Context, q Query) ([]Record, int, error)
+	ListSummary(ctx context.Context, q Query) ([]RecordSummary, int, error)
 	Delete(ctx context.Context, id string) error
 	ExportNDJSON(ctx context.Context, q Query) (io.ReadCloser, error)
 	Close() error
 }
+
+// Watcher is implemented by stores that can stream newly saved records.
+// The channel is closed once ctx is cancelled.
+type Watcher interface {
+	Watch(ctx context.Context) (<-chan Record, error)
+}
+
+// Flusher is implemented by stores that buffer writes and can force them to
+// durable storage
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Compactor is implemented by stores that can reclaim space left behind by
+// deleted or updated records
+type Compactor interface {
+	Compact(ctx context.Context) error
+}
+
+// PartitionDropper is implemented by stores partitioned by date that can
+// drop whole partitions ending at or before t, returning the records dropped
+type PartitionDropper interface {
+	DropBefore(ctx context.Context, t time.Time) (int, error)
+}
+
+// Modifier is implemented by stores that can change a record atomically, so
+// concurrent edits of different fields don't overwrite each other. change
+// is applied to the current version, which is stored unless it returns
+// false.
+type Modifier interface {
+	Modify(ctx context.Context, id string, change func(*Record) bool) (*Record, error)
+}
+
+// Modify changes a record through the store's Modifier, falling back to Get
+// and Update, which concurrent edits can race, for other stores
+func Modify(ctx context.Context, store Store, id string, change func(*Record) bool) (*Record, error) {
+	if modifier, ok := store.(Modifier); ok {
+		return modifier.Modify(ctx, id, change)
+	}
+
+	record, err := store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !change(record) {
+		return record, nil
+	}
+	if err := store.Update(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
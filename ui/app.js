@@ -17,6 +17,7 @@ class CaptureGatewayUI {
         this.searchInput = document.getElementById('search');
         this.providerFilter = document.getElementById('provider-filter');
         this.modelFilter = document.getElementById('model-filter');
+        this.kindFilter = document.getElementById('kind-filter');
         this.statusFilter = document.getElementById('status-filter');
         this.clearFiltersBtn = document.getElementById('clear-filters');
 
@@ -51,6 +52,7 @@ class CaptureGatewayUI {
         this.searchInput.addEventListener('input', this.debounce(() => this.applyFilters(), 300));
         this.providerFilter.addEventListener('change', () => this.applyFilters());
         this.modelFilter.addEventListener('input', this.debounce(() => this.applyFilters(), 300));
+        this.kindFilter.addEventListener('change', () => this.applyFilters());
         this.statusFilter.addEventListener('change', () => this.applyFilters());
         this.clearFiltersBtn.addEventListener('click', () => this.clearFilters());
 
@@ -114,6 +116,7 @@ class CaptureGatewayUI {
                 offset: this.currentPage * this.pageSize,
                 limit: this.pageSize,
                 sort: '-ts',
+                fields: 'summary',
                 ...this.currentFilters
             });
 
@@ -137,7 +140,7 @@ class CaptureGatewayUI {
         
         if (requests.length === 0) {
             const row = document.createElement('tr');
-            row.innerHTML = '<td colspan="9" class="text-center">No requests found</td>';
+            row.innerHTML = '<td colspan="10" class="text-center">No requests found</td>';
             this.requestsTbody.appendChild(row);
             return;
         }
@@ -152,6 +155,7 @@ class CaptureGatewayUI {
                 <td><span class="status-${request.status}">${request.status}</span></td>
                 <td>${request.duration_ms}ms</td>
                 <td>${request.model_hint || '-'}</td>
+                <td title="${this.escapeHTML(request.response_preview || '')}">${this.escapeHTML(this.truncate(request.title || request.request_preview || '-', 60))}</td>
                 <td>${request.stream ? '<span class="stream-badge">Stream</span>' : '-'}</td>
                 <td>
                     <button class="btn btn-primary view-btn" onclick="ui.viewRequest('${request.id}')">
@@ -188,6 +192,14 @@ class CaptureGatewayUI {
         document.getElementById('detail-req-size').textContent = this.formatBytes(record.size_req_bytes);
         document.getElementById('detail-res-size').textContent = this.formatBytes(record.size_res_bytes);
 
+        // Stream event types, e.g. "content_block_delta × 42"
+        const events = Object.entries(record.event_type_counts || {});
+        document.getElementById('detail-events-item').style.display = events.length > 0 ? '' : 'none';
+        document.getElementById('detail-events').textContent = events
+            .sort((a, b) => b[1] - a[1])
+            .map(([type, count]) => `${type} × ${count}`)
+            .join(', ');
+
         // Populate request tab
         document.getElementById('request-body').textContent = this.formatJSON(record.request_body);
 
@@ -302,6 +314,10 @@ class CaptureGatewayUI {
         if (this.modelFilter.value.trim()) {
             this.currentFilters.modelLike = this.modelFilter.value.trim();
         }
+
+        if (this.kindFilter.value) {
+            this.currentFilters.kind = this.kindFilter.value;
+        }
         
         if (this.statusFilter.value) {
             this.currentFilters.status = this.statusFilter.value;
@@ -315,6 +331,7 @@ class CaptureGatewayUI {
         this.searchInput.value = '';
         this.providerFilter.value = '';
         this.modelFilter.value = '';
+        this.kindFilter.value = '';
         this.statusFilter.value = '';
         this.currentFilters = {};
         this.currentPage = 0;
@@ -435,6 +452,10 @@ class CaptureGatewayUI {
         }
     }
 
+    escapeHTML(str) {
+        return str.replace(/[&<>"']/g, c => ({'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'}[c]));
+    }
+
     truncate(str, length) {
         if (str.length <= length) return str;
         return str.substring(0, length) + '...';
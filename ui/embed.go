@@ -0,0 +1,9 @@
+// Package ui bundles the web UI assets into the gateway binary
+package ui
+
+import "embed"
+
+// Assets holds the static UI files
+//
+//go:embed index.html app.js style.css
+var Assets embed.FS